@@ -1,3 +1,10 @@
+// tint of each car class so they can be told apart
+const TINTS = {
+    grip:  0x66ccff,
+    drift: 0xff9933,
+    heavy: 0x999999,
+};
+
 export class Car extends Phaser.Physics.Matter.Image
 {
     // assigned on creation. unique for each car
@@ -9,11 +16,14 @@ export class Car extends Phaser.Physics.Matter.Image
     // name of player controlling this car
     private nametag: Phaser.GameObjects.Text;
 
-    constructor(scene: Phaser.Scene, name: string, index)
+    constructor(scene: Phaser.Scene, name: string, index, spec?: any)
     {
         super(scene.matter.world, 0, 0, 'car');
         scene.add.existing(this);
 
+        if(spec !== undefined && TINTS[spec.class] !== undefined)
+            this.setTint(TINTS[spec.class]);
+
         this.index = index;
         this.percentage = 0;
 
@@ -33,8 +43,13 @@ export class Car extends Phaser.Physics.Matter.Image
         this.y              = carData.y;
         this.angle          = 360 + carData.rotation;
         this.percentage     = carData.progress;
-        this.name           = carData.name;
-        this.nametag.text   = carData.name;
+
+        // Binary updates do not repeat the name
+        if(carData.name !== undefined)
+        {
+            this.name           = carData.name;
+            this.nametag.text   = carData.name;
+        }
         
         this.nametag.setPosition(this.x, this.y-100);
     }
@@ -0,0 +1,219 @@
+/**
+ * Package physics is a port of the car physics of the server (see server/internal/player/player.go)
+ * so the client can predict its own car before the server confirms it.
+ *
+ * It calculates step by step what the server calculates (up to rounding differences of the
+ * browser's trigonometric functions which are corrected when the server's state arrives).
+ * Whenever the server's physics change this file has to follow
+ * (server/internal/player/testdata/physics.json holds a recorded drive to compare with)
+ */
+
+// STEP is the time step (in ms) car specs are tuned for. Velocities are given in distance per STEP
+export const STEP = 30;
+
+export interface Vector { x: number, y: number }
+
+export interface CarState
+{
+    x:        number,
+    y:        number,
+    rotation: number,   // in degrees
+    velocity: Vector,
+    offroad:  boolean,  // whether the car was off the track before its previous step (as the server only checks before moving)
+}
+
+function rad(alpha: number): number
+{
+    return alpha * (Math.PI / 180.0);
+}
+
+function rotate(v: Vector, alpha: number): Vector
+{
+    let cos = Math.cos(rad(alpha)), sin = Math.sin(rad(alpha));
+    return { x: cos*v.x - sin*v.y, y: sin*v.x + cos*v.y };
+}
+
+function len(v: Vector): number
+{
+    return Math.sqrt(v.x*v.x + v.y*v.y);
+}
+
+function angle(v: Vector): number
+{
+    let a = Math.atan2(v.y, v.x);
+    if(a < 0)
+        a += 2 * Math.PI;
+
+    return a * (180 / Math.PI);
+}
+
+function clamp(x: number, min: number, max: number): number
+{
+    return x < min ? min : x > max ? max : x;
+}
+
+/**
+ * controls returns steering in [-1, 1] as well as throttle and brake in [0, 1].
+ * Pressed arrow keys take precedence over the analog values
+ */
+export function controls(input): [number, number, number]
+{
+    let steer    = clamp(input.steer || 0, -1, 1);
+    let throttle = clamp(input.throttle || 0, 0, 1);
+    let brake    = clamp(input.brake || 0, 0, 1);
+
+    if(input.left)
+        steer = -1;
+    else if(input.right)
+        steer = 1;
+
+    if(input.up)
+        throttle = 1;
+
+    if(input.down)
+        brake = 1;
+
+    return [steer, throttle, brake];
+}
+
+/**
+ * step moves the car on the track by `dt` milliseconds with the given input and car spec (as sent in init)
+ */
+export function step(state: CarState, input, spec, dt: number, track): CarState
+{
+    let scale = dt / STEP;
+    let [steer, throttle, brake] = controls(input);
+    let steerangle = steer * spec.turnSpeed;
+
+    let direction = rotate({ x: 1, y: 0 }, state.rotation);
+
+    let acceleration = { x: 0, y: 0 };
+    if(throttle > 0)
+        acceleration = { x: direction.x * (spec.enginePower * throttle), y: direction.y * (spec.enginePower * throttle) };
+
+    // Braking overrides the throttle
+    if(brake > 0)
+        acceleration = { x: direction.x * (spec.brakePower * brake), y: direction.y * (spec.brakePower * brake) };
+
+    // Apply drag and friction
+    let friction = state.offroad ? spec.offTrackFriction : spec.onTrackFriction;
+    let drag = len(state.velocity) * spec.drag;
+
+    acceleration.x = (acceleration.x + state.velocity.x * friction + state.velocity.x * drag) * scale;
+    acceleration.y = (acceleration.y + state.velocity.y * friction + state.velocity.y * drag) * scale;
+
+    let velocity = { x: state.velocity.x + acceleration.x, y: state.velocity.y + acceleration.y };
+
+    // Calculate next position
+    let cos = Math.cos(rad(state.rotation)), sin = Math.sin(rad(state.rotation));
+    let front = { x: state.x + cos*(spec.wheelbase/2), y: state.y + sin*(spec.wheelbase/2) };
+    let rear  = { x: state.x + cos*(-spec.wheelbase/2), y: state.y + sin*(-spec.wheelbase/2) };
+
+    let moved = { x: velocity.x * scale, y: velocity.y * scale };
+    rear.x += moved.x;
+    rear.y += moved.y;
+
+    moved = rotate(moved, steerangle); // Apply steering to front wheel
+    front.x += moved.x;
+    front.y += moved.y;
+
+    let heading = { x: front.x - rear.x, y: front.y - rear.y };
+    let length = len(heading);
+    let speed = len(velocity);
+    heading = { x: heading.x / length * speed, y: heading.y / length * speed };
+
+    let traction = 1 - Math.pow(1 - spec.traction, scale);
+    velocity = { x: velocity.x + (heading.x - velocity.x) * traction, y: velocity.y + (heading.y - velocity.y) * traction };
+
+    // Do not allow reversing
+    if(velocity.x * heading.x + velocity.y * heading.y < 0)
+        velocity = { x: 0, y: 0 };
+
+    // Move
+    let rotation = len(heading) !== 0 ? angle(heading) : state.rotation;
+
+    return {
+        x:        state.x + velocity.x * scale,
+        y:        state.y + velocity.y * scale,
+        rotation: rotation,
+        velocity: velocity,
+        offroad:  offroad(state.x, state.y, track),
+    };
+}
+
+/**
+ * offroad reports whether no point of the track's center line is in range of the position
+ */
+export function offroad(x: number, y: number, track): boolean
+{
+    for(let p of track.center)
+    {
+        let dx = x - p.x, dy = y - p.y;
+        if(dx*dx + dy*dy <= track.width * track.width)
+            return false;
+    }
+
+    return true;
+}
+
+/**
+ * Predictor moves our own car ahead with the inputs the server has not confirmed yet.
+ * Every server state of the car resets the prediction and replays the steps that are still pending
+ */
+export class Predictor
+{
+    // steps taken locally with the sequence number of the input that was sent
+    private steps: Array<{ seq: number, input: any }> = [];
+
+    // the game cycle the server applied an input first
+    private since = new Map<number, number>();
+
+    public state: CarState | undefined;
+
+    constructor(private spec, public readonly dt: number, private track) {}
+
+    /**
+     * step predicts the next game cycle with the input tagged by seq (returns undefined before the first server state)
+     */
+    step(input, seq: number): CarState | undefined
+    {
+        if(this.state === undefined)
+            return undefined;
+
+        this.steps.push({ seq: seq, input: input });
+        this.state = step(this.state, input, this.spec, this.dt, this.track);
+
+        return this.state;
+    }
+
+    /**
+     * reconcile corrects the prediction with the car's state of the server
+     * (which echoes the latest input it applied in `lastSeq` and its game cycle in `tick`)
+     */
+    reconcile(car): CarState
+    {
+        if(!this.since.has(car.lastSeq))
+            this.since.set(car.lastSeq, car.tick);
+
+        for(let seq of this.since.keys())
+            if(seq < car.lastSeq)
+                this.since.delete(seq);
+
+        // the latest input has been applied in every cycle since it arrived, the following ones not at all
+        let applied = car.tick - (this.since.get(car.lastSeq) as number) + 1;
+        this.steps = this.steps.filter(s => s.seq > car.lastSeq || (s.seq === car.lastSeq && applied-- <= 0));
+
+        this.state = {
+            x:        car.x,
+            y:        car.y,
+            rotation: car.rotation,
+            velocity: car.velocity || { x: 0, y: 0 },
+            offroad:  offroad(car.x, car.y, this.track),
+        };
+
+        for(let s of this.steps)
+            this.state = step(this.state, s.input, this.spec, this.dt, this.track);
+
+        return this.state;
+    }
+}
@@ -3,6 +3,7 @@
  * the data to a format understandable by both client and server
  * 
  * Every messages is a string structured as `<prefix>|<data>`
+ * unless the binary subprotocol was negotiated (see BINARY_PROTOCOL)
  */
 const Protocol = {    
     /**
@@ -20,8 +21,29 @@ const Protocol = {
     CLOSEDOWN:  "close",        // (server -> client) server counts down to zero before race will end
     BESTLIST:   "best",         // (server -> client) server sends the ranking
     REST:       "rest",         // (server -> client) server sends the countdown to the next game will start soon
-    INPUT:      "input",        // (client -> server) client sends what arrow-keys are pressed
-    HELLO:      "hello",        // (client -> server) client introduces himself and tells server his name
+    SENSORS:    "sensors",      // (server -> client) server sends the sensor readings of the client's car (after SENSE)
+    DELTA:      "delta",        // (server -> client) server sends the changes of the game state since a snapshot the client acknowledged (instead of UPDATE)
+    ERROR:      "error",        // (server -> client) server tells why a message could not be handled ({code, message})
+    SHUTDOWN:   "shutdown",     // (server -> client) server is going away and closes the connection right after
+    INPUT:      "input",        // (client -> server) client sends what arrow-keys are pressed (or analog steer, throttle and brake)
+    HELLO:      "hello",        // (client -> server) client introduces himself with {version, name, car} (car is optional)
+    SENSE:      "sense",        // (client -> server) client asks to receive sensor readings configured by the payload
+    ACK:        "ack",          // (client -> server) client acknowledges the sequence number of the latest DELTA it applied
+
+    /**
+     * Subprotocols to ask for when opening the websocket connection (in order of preference).
+     * With the binary subprotocol every message from the server is a binary frame `<code><payload>`
+     * where updates are packed tightly and every other payload is JSON.
+     * Messages to the server are always text
+     */
+    JSON_PROTOCOL:   "sennai.json",
+    BINARY_PROTOCOL: "sennai.binary",
+
+    // VERSION of the protocol this client speaks (mirrors Version in server/internal/protocol/message.go)
+    VERSION: 1,
+
+    // CODES are the prefixes of binary frames by their code (mirrors codes in server/internal/protocol/binary.go)
+    CODES: ["init", "update", "join", "leave", "newtrack", "count", "close", "best", "rest", "sensors", "delta", "error", "shutdown"],
 
     /**
      * send will transfer messages to the server in compliance with the protocol.
@@ -36,12 +58,146 @@ const Protocol = {
     },
 
     /**
-     * parse will extract the content of a message sent by the client
-     * which complies with the protocol
+     * parse will extract the content of a message sent by the server
+     * which complies with the protocol (either a text or a binary frame)
      */
     parse: function(message): [string, any]
     {
-        return [message.split("|")[0], JSON.parse(message.split("|")[1])];
+        if(message instanceof ArrayBuffer)
+            return Protocol.parseBinary(message);
+
+        let split = message.indexOf("|");
+        return [message.substring(0, split), JSON.parse(message.substring(split + 1))];
+    },
+
+    /**
+     * parseBinary extracts the content of a binary frame
+     */
+    parseBinary: function(message: ArrayBuffer): [string, any]
+    {
+        let view = new DataView(message);
+        let prefix = Protocol.CODES[view.getUint8(0)];
+
+        if(prefix === Protocol.UPDATE)
+            return [prefix, Protocol.decodeUpdate(new DataView(message, 1))];
+
+        if(prefix === Protocol.DELTA)
+            return [prefix, Protocol.decodeDelta(new DataView(message, 1))];
+
+        return [prefix, JSON.parse(new TextDecoder().decode(new Uint8Array(message, 1)))];
+    },
+
+    /**
+     * decodeUpdate unpacks the cars of a binary update.
+     * The game cycle (uint32) and the amount of cars (uint16) are followed by 21 bytes per car (little endian):
+     * id (uint16), x and y (int32 in tenths), rotation (uint16 in 1/65536 of a turn), progress (uint8 in percent),
+     * the last applied input (uint32) and the velocity (2 int16 in hundredths)
+     */
+    decodeUpdate: function(view: DataView): Array<any>
+    {
+        let cars: Array<any> = [];
+        let tick = view.getUint32(0, true);
+        let count = view.getUint16(4, true);
+
+        for(let i = 0; i < count; i++)
+        {
+            let offset = 6 + i * 21;
+            cars.push({
+                id:       view.getUint16(offset, true),
+                x:        view.getInt32(offset + 2, true) / 10,
+                y:        view.getInt32(offset + 6, true) / 10,
+                rotation: view.getUint16(offset + 10, true) * 360 / 65536,
+                progress: view.getUint8(offset + 12),
+                lastSeq:  view.getUint32(offset + 13, true),
+                velocity: { x: view.getInt16(offset + 17, true) / 100, y: view.getInt16(offset + 19, true) / 100 },
+                tick:     tick,
+            });
+        }
+
+        return cars;
+    },
+
+    /**
+     * decodeDelta unpacks a binary delta into the same form as a JSON delta.
+     * seq, base and the game cycle (uint32) and the amount of changed cars (uint16) are followed by every changed car as
+     * id (uint16), fields (uint8) and the changed fields in the order x, y (int32), rotation (uint16),
+     * progress (uint8), name (uint8 length + UTF-8), last applied input (uint32), velocity (2 int16),
+     * then the amount of removed cars (uint16) and their ids (uint16)
+     */
+    decodeDelta: function(view: DataView): any
+    {
+        let delta = { seq: view.getUint32(0, true), base: view.getUint32(4, true), tick: view.getUint32(8, true), cars: [] as Array<any>, removed: [] as Array<number> };
+        let count = view.getUint16(12, true);
+        let offset = 14;
+
+        for(let i = 0; i < count; i++)
+        {
+            let car: any = { id: view.getUint16(offset, true) };
+            let fields = view.getUint8(offset + 2);
+            offset += 3;
+
+            if(fields & 1) { car.x = view.getInt32(offset, true) / 10; offset += 4; }
+            if(fields & 2) { car.y = view.getInt32(offset, true) / 10; offset += 4; }
+            if(fields & 4) { car.rotation = view.getUint16(offset, true) * 360 / 65536; offset += 2; }
+            if(fields & 8) { car.progress = view.getUint8(offset); offset += 1; }
+            if(fields & 16)
+            {
+                let length = view.getUint8(offset);
+                car.name = new TextDecoder().decode(new Uint8Array(view.buffer, view.byteOffset + offset + 1, length));
+                offset += 1 + length;
+            }
+            if(fields & 32) { car.lastSeq = view.getUint32(offset, true); offset += 4; }
+            if(fields & 64)
+            {
+                car.velocity = { x: view.getInt16(offset, true) / 100, y: view.getInt16(offset + 2, true) / 100 };
+                offset += 4;
+            }
+
+            delta.cars.push(car);
+        }
+
+        let removed = view.getUint16(offset, true);
+        for(let i = 0; i < removed; i++)
+            delta.removed.push(view.getUint16(offset + 2 + i * 2, true));
+
+        return delta;
+    }
+}
+
+/**
+ * Snapshots keeps the game states received as deltas so that following deltas can be applied to them
+ */
+export class Snapshots
+{
+    // as many as the server keeps (see history in server/internal/protocol/delta.go)
+    private static readonly SIZE = 64;
+
+    private states = new Map<number, Map<number, any>>();
+
+    /**
+     * apply returns the cars of the game state described by the delta
+     * or undefined if the snapshot it is based on is not known (anymore)
+     */
+    apply(delta): Array<any> | undefined
+    {
+        let base = delta.base === 0 ? new Map<number, any>() : this.states.get(delta.base);
+        if(base === undefined)
+            return undefined;
+
+        let state = new Map<number, any>(base);
+        for(let id of delta.removed)
+            state.delete(id);
+
+        for(let car of delta.cars)
+            state.set(car.id, Object.assign({}, state.get(car.id), car));
+
+        for(let [id, car] of state)
+            state.set(id, Object.assign({}, car, { tick: delta.tick }));
+
+        this.states.set(delta.seq, state);
+        this.states.delete(delta.seq - Snapshots.SIZE);
+
+        return Array.from(state.values());
     }
 }
 
@@ -33,7 +33,7 @@ export default class FinishScene extends Phaser.Scene
         {
             console.log("THIS IS NOT HAPPENING");
             this.socket = new WebSocket(ENDPOINT);
-            this.socket.onopen = () => Protocol.send(this.socket, Protocol.HELLO, this.registry.get('name'));
+            this.socket.onopen = () => Protocol.send(this.socket, Protocol.HELLO, { version: Protocol.VERSION, name: this.registry.get('name') });
             this.registry.set('socket', this.socket);
         }
         this.socket.onmessage = ({data}) => this.read(data);
@@ -94,8 +94,9 @@ export default class FinishScene extends Phaser.Scene
             let name        = this.pad(bestlist[i].name, 12);
             let time        = this.pad(this.formatTime(bestlist[i].finishTime), 10);
             let progress    = this.pad(bestlist[i].progress, 3);
+            let walls       = bestlist[i].wallHits > 0 ? ` - ${bestlist[i].wallHits} wall hits` : '';
             
-            string.push(`${position}. ${name} | ${time} - ${progress}%`);
+            string.push(`${position}. ${name} | ${time} - ${progress}%${walls}`);
         }
 
         this.bestlistText.setText(string);
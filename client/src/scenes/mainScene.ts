@@ -1,5 +1,6 @@
 import { Car } from '../car';
-import Protocol from '../protocol';
+import Protocol, { Snapshots } from '../protocol';
+import { Predictor } from '../physics';
 import { ENDPOINT } from '../globals';
 
 export default class MainScene extends Phaser.Scene
@@ -25,7 +26,7 @@ export default class MainScene extends Phaser.Scene
     // displayed on the nametag
     private name: string;
 
-    // which car that represents us and we will follow with the camera
+    // which car that represents us and we will follow with the camera (-1 if we are spectating)
     private id: number = 0;
     
     // Start-to-race countdown
@@ -44,6 +45,18 @@ export default class MainScene extends Phaser.Scene
 
     // conection to the server
     private socket: WebSocket;
+
+    // game states received as deltas (when asked for with ?delta=1)
+    private snapshots: Snapshots;
+
+    // sequence number of the latest input sent so the server can tell which one it applied
+    private seq: number = 0;
+
+    // predicts our own car until the server confirms it (when asked for with ?predict=1)
+    private predictor: Predictor | undefined;
+
+    // milliseconds not yet predicted
+    private accumulator: number = 0;
     
     // Debug
     zoom = 0.3;
@@ -68,17 +81,35 @@ export default class MainScene extends Phaser.Scene
         
         if(this.socket === undefined) // On first visit, otherwise this is defined already
         {
-            this.socket = new WebSocket(ENDPOINT);
-            this.socket.onopen = () => Protocol.send(this.socket, Protocol.HELLO, this.registry.get('name'));
+            // Join the room given in the page URL (e.g. ?room=team-a), otherwise the server picks the default room.
+            // With ?spectate=1 in the page URL we only watch without getting a car
+            // and with ?json=1 messages are sent as readable text instead of binary (for debugging).
+            // With ?delta=1 only changes of the game state are sent
+            let params = new URLSearchParams(window.location.search);
+            let query = new URLSearchParams();
+            if(params.get('room'))
+                query.set('room', params.get('room') as string);
+            if(params.get('spectate'))
+                query.set('spectate', '1');
+            if(params.get('delta'))
+                query.set('delta', '1');
+
+            let protocols = params.get('json') ? [Protocol.JSON_PROTOCOL] : [Protocol.BINARY_PROTOCOL, Protocol.JSON_PROTOCOL];
+
+            this.socket = new WebSocket(query.toString() ? ENDPOINT + '?' + query.toString() : ENDPOINT, protocols);
+            this.socket.binaryType = 'arraybuffer';
+            this.socket.onopen = () => Protocol.send(this.socket, Protocol.HELLO, this.hello());
             this.registry.set('socket', this.socket);
+            this.registry.set('snapshots', new Snapshots());
         }
         else // We have completed a round and revisit this scene again for a new race
         {
             let latest = this.registry.get('track');
             this.track = latest.track;
             
-            Protocol.send(this.socket, Protocol.HELLO, this.registry.get('name'));
+            Protocol.send(this.socket, Protocol.HELLO, this.hello());
         }
+        this.snapshots = this.registry.get('snapshots');
         this.socket.onmessage = ({data}) => this.read(data);
         
         this.input.on('wheel', (a, b, c, deltaY) => {
@@ -114,11 +145,12 @@ export default class MainScene extends Phaser.Scene
         this.cameras.main.setZoom(this.zoom);
     }
     
-    update()
+    update(time, delta)
     {
         this.graphics.clear();
 
         this.readControls();
+        this.predict(delta);
         //this.cameras.main.shake(1000, 0.025);
 
         //this.drawTrack();
@@ -126,6 +158,16 @@ export default class MainScene extends Phaser.Scene
         this.debug();
     }
 
+    // hello introduces the player with their name and the car class given in the page URL (e.g. ?car=drift)
+    hello()
+    {
+        let car = new URLSearchParams(window.location.search).get('car');
+        if(car === null)
+            return { version: Protocol.VERSION, name: this.registry.get('name') };
+
+        return { version: Protocol.VERSION, name: this.registry.get('name'), car: car };
+    }
+
     // readControls sends player inputs to the server
     // they are sent in such a way that only a *change* in input is reported to the server
     readControls()
@@ -141,17 +183,42 @@ export default class MainScene extends Phaser.Scene
         this.upKeyPressed = this.cursors.up.isDown;
         this.downKeyPressed = this.cursors.down.isDown;
 
+        if (this.id < 0) // spectators have no car to control
+            return;
+
         if (oldLeft !== this.leftKeyPressed || oldRight !== this.rightKeyPressed || oldUp !== this.upKeyPressed || oldDown !== this.downKeyPressed)
         {
             if(this.socket.readyState !== WebSocket.OPEN)
                 return
             
-            Protocol.send(this.socket, 'input', {
-                left: this.leftKeyPressed,
-                right: this.rightKeyPressed,
-                up: this.upKeyPressed,
-                down: this.downKeyPressed
-            });
+            Protocol.send(this.socket, 'input', Object.assign({ seq: ++this.seq }, this.controls()));
+        }
+    }
+
+    controls()
+    {
+        return {
+            left: this.leftKeyPressed,
+            right: this.rightKeyPressed,
+            up: this.upKeyPressed,
+            down: this.downKeyPressed
+        };
+    }
+
+    // predict moves our own car ahead by the elapsed milliseconds in steps of the server's game cycle
+    predict(delta)
+    {
+        if(this.predictor === undefined || this.cars[this.id] === undefined)
+            return;
+
+        this.accumulator += delta;
+        while(this.accumulator >= this.predictor.dt)
+        {
+            this.accumulator -= this.predictor.dt;
+
+            let state = this.predictor.step(this.controls(), this.seq);
+            if(state !== undefined)
+                this.cars[this.id].update(Object.assign({ progress: this.cars[this.id].percentage }, state));
         }
     }
 
@@ -193,6 +260,15 @@ export default class MainScene extends Phaser.Scene
                 this.updateGame(payload);
                 break;
 
+            case Protocol.DELTA:
+                let cars = this.snapshots.apply(payload);
+                if(cars === undefined) // we missed the base so wait for the server to send a keyframe
+                    break;
+
+                Protocol.send(this.socket, Protocol.ACK, payload.seq);
+                this.updateGame(cars);
+                break;
+
             case Protocol.COUNTDOWN:
                 this.countDown(payload);
                 break;
@@ -212,6 +288,14 @@ export default class MainScene extends Phaser.Scene
             case Protocol.LEAVE:
                 this.playerLeft(payload);
                 break;
+
+            case Protocol.SHUTDOWN:
+                this.topNumber.setText('Server is restarting');
+                break;
+
+            case Protocol.ERROR:
+                console.error(`server rejected a message (${payload.code}): ${payload.message}`);
+                break;
         }
     }
 
@@ -222,9 +306,16 @@ export default class MainScene extends Phaser.Scene
         this.cars   = [];
 
         for(let car of initPackage.cars)
-            this.cars.push(new Car(this, car.name, car.id));
+            this.cars.push(new Car(this, car.name, car.id, initPackage.specs[car.id]));
+
+        this.predictor = undefined;
+        if(new URLSearchParams(window.location.search).get('predict') && this.id >= 0)
+            this.predictor = new Predictor(initPackage.specs[this.id], initPackage.dt, this.track);
         
-        this.cameras.main.startFollow(this.cars[this.id], false);
+        // Spectators follow the first car
+        let followed = this.id < 0 ? this.cars[0] : this.cars[this.id];
+        if(followed !== undefined)
+            this.cameras.main.startFollow(followed, false);
 
         console.log(this.cars);
     }
@@ -238,6 +329,12 @@ export default class MainScene extends Phaser.Scene
             if(this.cars[car.id] === undefined) 
                 return;
 
+            if(car.id === this.id && this.predictor !== undefined)
+            {
+                this.cars[car.id].update(Object.assign({}, car, this.predictor.reconcile(car)));
+                continue;
+            }
+
             this.cars[car.id].update(car);
         }
     }
@@ -286,7 +383,8 @@ export default class MainScene extends Phaser.Scene
         if(player.id == this.id)
             return;
 
-        this.cars.push(new Car(this, player.name, player.id));
+        // JOIN carries the car spec the player chose (INIT sends them as specs instead)
+        this.cars.push(new Car(this, player.name, player.id, player.car));
         
         let current = this.registry.get('cars');
         current.push(player);
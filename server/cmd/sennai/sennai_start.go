@@ -4,31 +4,171 @@ import (
 	//"encoding/json"
 	//"fmt"
 
+	"context"
+	"encoding/json"
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
+	"gitlab.com/resamvi/sennai/internal/config"
 	"gitlab.com/resamvi/sennai/internal/game"
 	"gitlab.com/resamvi/sennai/internal/player"
+	"gitlab.com/resamvi/sennai/internal/protocol"
+	"gitlab.com/resamvi/sennai/internal/replay"
+	"gitlab.com/resamvi/sennai/internal/track"
 )
 
 func main() {
-	l := game.New()
-	go l.Run()
+	verify := flag.String("verify", "", "re-simulate the given replay file to check it for determinism and exit")
+	dump := flag.Bool("print-config", false, "print the configuration as JSON and exit")
+
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:], os.LookupEnv)
+	if err != nil {
+		log.Fatal("Loading configuration: " + err.Error())
+	}
+
+	// Printed before validating so it can be seen why a configuration is invalid
+	if *dump {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		err = enc.Encode(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		log.Fatal("Invalid configuration: " + err.Error())
+	}
+
+	if *dump {
+		return
+	}
+
+	if *verify != "" {
+		verifyReplay(*verify)
+		return
+	}
+
+	for _, spec := range cfg.Classes {
+		player.SetClass(spec)
+	}
+	protocol.AllowHosts(cfg.Origins)
+
+	tracks := func() track.Source {
+		return track.Generator{Config: track.Default}
+	}
+
+	if cfg.Tracks != "" {
+		list, err := track.LoadDir(cfg.Tracks)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		tracks = func() track.Source {
+			return track.NewRotation(list)
+		}
+
+		log.Printf("Loaded %d tracks from %s\n", len(list), cfg.Tracks)
+	}
+
+	l := game.NewLobby(func() game.Settings {
+		return cfg.Settings(tracks())
+	})
 
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		game.ServeWs(l, w, r)
 	})
 
+	http.HandleFunc("/rooms", func(w http.ResponseWriter, r *http.Request) {
+		game.ServeRooms(l, w, r)
+	})
+
 	http.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("Hello, I'm up!"))
 	})
 
+	http.HandleFunc("/track", track.ServeTrack)
+
+	http.HandleFunc("/replay", func(w http.ResponseWriter, r *http.Request) {
+		if cfg.Replays == "" {
+			http.Error(w, "replays are disabled", http.StatusNotFound)
+			return
+		}
+
+		// Only serve files from the replay directory
+		name := filepath.Base(r.URL.Query().Get("file"))
+		rp, err := replay.Load(filepath.Join(cfg.Replays, name))
+		if err != nil {
+			http.Error(w, "unknown replay: "+name, http.StatusNotFound)
+			return
+		}
+
+		game.ServePlayback(rp, w, r)
+	})
+
 	http.HandleFunc("/playerdebug", player.ChangeVar)
 
 	http.HandleFunc("/gamedebug", func(w http.ResponseWriter, r *http.Request) {
 		game.ServeDebug(l, w, r)
 	})
 
-	log.Println("Starting on Port :7999")
-	log.Fatal(http.ListenAndServe(":7999", nil))
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	server := &http.Server{Addr: cfg.Addr}
+	go func() {
+		log.Println("Starting on " + cfg.Addr)
+
+		var err error
+		if cfg.TLSCert != "" {
+			err = server.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			err = server.ListenAndServe()
+		}
+
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Shutdown))
+	defer cancel()
+
+	// Websockets are not tracked by the server so the lobby closes them
+	err = server.Shutdown(ctx)
+	if err != nil {
+		log.Println(err)
+	}
+
+	err = l.Shutdown(ctx)
+	if err != nil {
+		log.Println("Gave up waiting for connections: " + err.Error())
+	}
+}
+
+// verifyReplay checks whether the race of a replay file can be reproduced from its inputs
+func verifyReplay(path string) {
+	rp, err := replay.Load(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = game.Verify(rp)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Replay %s is deterministic (%d frames)\n", path, len(rp.Frames))
 }
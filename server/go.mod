@@ -1,5 +1,5 @@
 module gitlab.com/resamvi/sennai
 
-go 1.15
+go 1.18
 
 require github.com/gorilla/websocket v1.4.2
@@ -0,0 +1,253 @@
+// Package config contains the settings of the server.
+// They are loaded from a JSON file, environment variables and command line flags
+// where the latter override the former (see Load)
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gitlab.com/resamvi/sennai/internal/game"
+	"gitlab.com/resamvi/sennai/internal/player"
+	"gitlab.com/resamvi/sennai/internal/track"
+)
+
+// Config is everything that can be configured about the server
+type Config struct {
+	Addr     string   `json:"addr"`     // address to listen on
+	TLSCert  string   `json:"tlsCert"`  // certificate file to serve TLS with (together with TLSKey)
+	TLSKey   string   `json:"tlsKey"`   // private key file of the certificate
+	Origins  []string `json:"origins"`  // hosts of the pages the game can be played from (see protocol.AllowHosts)
+	Tracks   string   `json:"tracks"`   // directory of track files to race on in rotation instead of generated tracks
+	Replays  string   `json:"replays"`  // directory to save replays of finished races to
+	Results  string   `json:"results"`  // directory to save the standings of finished races to
+	Shutdown Duration `json:"shutdown"` // time to finish up games and connections before exiting
+
+	Room    Room             `json:"room"`    // defaults of every room
+	Phases  Phases           `json:"phases"`  // durations of the phases of a race
+	Classes []player.CarSpec `json:"classes"` // car classes to add (or replace presets of the same name)
+}
+
+// Room are the defaults of a room (see game.Settings)
+type Room struct {
+	Laps        int      `json:"laps"`
+	Checkpoints int      `json:"checkpoints"`
+	Ghost       bool     `json:"ghost"`
+	Walls       bool     `json:"walls"`
+	Tick        Duration `json:"tick"`
+	Broadcast   Duration `json:"broadcast"` // 0 to broadcast every tick
+	Car         string   `json:"car"`       // car class players drive until they pick one
+}
+
+// Phases are the durations of the phases of a race
+type Phases struct {
+	Countdown Duration `json:"countdown"` // until the race starts
+	Closedown Duration `json:"closedown"` // after the first player finished
+	Rest      Duration `json:"rest"`      // while the bestlist is shown
+}
+
+// Default returns the configuration used when nothing is configured
+func Default() Config {
+	return Config{
+		Addr:     ":7999",
+		Origins:  []string{"localhost:7999", "localhost:8080", "online.resamvi.io"},
+		Shutdown: Duration(10 * time.Second),
+		Room: Room{
+			Laps:        1,
+			Checkpoints: 8,
+			Tick:        Duration(player.Step),
+			Car:         player.Standard.Class,
+		},
+		Phases: Phases{
+			Countdown: Duration(7 * time.Second),
+			Closedown: Duration(5 * time.Second),
+			Rest:      Duration(6 * time.Second),
+		},
+		Classes: []player.CarSpec{},
+	}
+}
+
+// Load builds the configuration from the defaults overridden by the JSON file given by
+// the `config` flag (or the SENNAI_CONFIG environment variable), the environment variables and the flags.
+// The flags are registered on the flag set and parsed from the arguments.
+// Every flag `some-name` can be set with the environment variable SENNAI_SOME_NAME as well.
+// The configuration is not validated so it can be inspected even if it is invalid (see Validate)
+func Load(fs *flag.FlagSet, args []string, lookup func(string) (string, bool)) (Config, error) {
+	file := fs.String("config", "", "JSON file to load the configuration from")
+
+	flagged := Default()
+	for _, o := range options {
+		fs.Var(o.value(&flagged), o.name, o.usage)
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg := Default()
+
+	path, ok := lookup(env("config"))
+	if *file != "" {
+		path, ok = *file, true
+	}
+
+	if ok && path != "" {
+		err = cfg.load(path)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, o := range options {
+		v, ok := lookup(env(o.name))
+		if !ok {
+			continue
+		}
+
+		err = o.value(&cfg).Set(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("%s: %v", env(o.name), err)
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if o, ok := find(f.Name); ok && err == nil {
+			err = o.value(&cfg).Set(f.Value.String())
+		}
+	})
+	if err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// load overrides the configuration with the fields set in the JSON file
+func (c *Config) load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(c)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	return nil
+}
+
+// Validate checks whether the server can be started as configured
+func (c Config) Validate() error {
+	if c.Addr == "" {
+		return errors.New("addr must not be empty")
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("tlsCert and tlsKey have to be given together")
+	}
+
+	if len(c.Origins) == 0 {
+		return errors.New("origins must not be empty")
+	}
+
+	if c.Shutdown <= 0 {
+		return errors.New("shutdown must be positive")
+	}
+
+	if c.Room.Laps < 1 || c.Room.Checkpoints < 1 {
+		return errors.New("laps and checkpoints must be positive")
+	}
+
+	tick := time.Duration(c.Room.Tick)
+	if tick < game.MinTick || tick > game.MaxTick {
+		return fmt.Errorf("tick must be between %v and %v", game.MinTick, game.MaxTick)
+	}
+
+	if c.Room.Broadcast != 0 && time.Duration(c.Room.Broadcast) < game.MinTick {
+		return fmt.Errorf("broadcast must be at least %v", game.MinTick)
+	}
+
+	if time.Duration(c.Phases.Countdown) < 100*time.Millisecond || time.Duration(c.Phases.Closedown) < 100*time.Millisecond {
+		return errors.New("countdown and closedown must be at least 100ms")
+	}
+
+	if time.Duration(c.Phases.Rest) < time.Second {
+		return errors.New("rest must be at least 1s")
+	}
+
+	known := c.Room.Car == ""
+	if _, ok := player.Class(c.Room.Car); ok {
+		known = true
+	}
+
+	for _, spec := range c.Classes {
+		err := spec.Validate()
+		if err != nil {
+			return fmt.Errorf("class %q: %v", spec.Class, err)
+		}
+
+		if spec.Class == c.Room.Car {
+			known = true
+		}
+	}
+
+	if !known {
+		return fmt.Errorf("unknown car class: %s", c.Room.Car)
+	}
+
+	return nil
+}
+
+// Settings returns the settings of a room racing on tracks of the source
+func (c Config) Settings(tracks track.Source) game.Settings {
+	return game.Settings{
+		Tracks:      tracks,
+		Replays:     c.Replays,
+		Results:     c.Results,
+		Laps:        c.Room.Laps,
+		Checkpoints: c.Room.Checkpoints,
+		Ghost:       c.Room.Ghost,
+		Walls:       c.Room.Walls,
+		Tick:        time.Duration(c.Room.Tick),
+		Broadcast:   time.Duration(c.Room.Broadcast),
+		Countdown:   time.Duration(c.Phases.Countdown),
+		Closedown:   time.Duration(c.Phases.Closedown),
+		Rest:        time.Duration(c.Phases.Rest),
+		Car:         c.Room.Car,
+	}
+}
+
+// Duration is a time.Duration that is written as string (e.g. "30ms") in JSON
+type Duration time.Duration
+
+// MarshalJSON writes the duration as string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON reads the duration from a string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/resamvi/sennai/internal/player"
+)
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sennai.json")
+	err := ioutil.WriteFile(file, []byte(`{"addr": ":8000", "room": {"laps": 3, "tick": "20ms"}, "phases": {"rest": "10s"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		env   map[string]string
+		check func(Config) bool
+	}{
+		{"defaults", nil, nil, func(c Config) bool {
+			return c.Addr == ":7999" && c.Room.Laps == 1 && time.Duration(c.Room.Tick) == 30*time.Millisecond
+		}},
+		{"file", []string{"-config", file}, nil, func(c Config) bool {
+			return c.Addr == ":8000" && c.Room.Laps == 3 && c.Room.Checkpoints == 8 && time.Duration(c.Phases.Rest) == 10*time.Second
+		}},
+		{"file from env", nil, map[string]string{"SENNAI_CONFIG": file}, func(c Config) bool {
+			return c.Addr == ":8000"
+		}},
+		{"env over file", []string{"-config", file}, map[string]string{"SENNAI_LAPS": "5", "SENNAI_ORIGINS": "a.io, b.io"}, func(c Config) bool {
+			return c.Room.Laps == 5 && c.Addr == ":8000" && strings.Join(c.Origins, ",") == "a.io,b.io"
+		}},
+		{"flags over env", []string{"-config", file, "-laps", "7", "-ghost", "-tls-cert", "c.pem", "-tls-key", "k.pem"}, map[string]string{"SENNAI_LAPS": "5"}, func(c Config) bool {
+			return c.Room.Laps == 7 && c.Room.Ghost && c.TLSCert == "c.pem" && time.Duration(c.Room.Tick) == 20*time.Millisecond
+		}},
+		{"invalid is loaded to be inspected", []string{"-laps", "0"}, nil, func(c Config) bool {
+			return c.Room.Laps == 0 && c.Validate() != nil
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(flag.NewFlagSet("sennai", flag.ContinueOnError), tt.args, func(key string) (string, bool) {
+				v, ok := tt.env[key]
+				return v, ok
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.check(cfg) {
+				t.Errorf("got %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		valid  bool
+	}{
+		{"default", func(c *Config) {}, true},
+		{"no address", func(c *Config) { c.Addr = "" }, false},
+		{"cert without key", func(c *Config) { c.TLSCert = "cert.pem" }, false},
+		{"no origins", func(c *Config) { c.Origins = nil }, false},
+		{"no laps", func(c *Config) { c.Room.Laps = 0 }, false},
+		{"tick too short", func(c *Config) { c.Room.Tick = Duration(time.Millisecond) }, false},
+		{"tick too long", func(c *Config) { c.Room.Tick = Duration(time.Second) }, false},
+		{"broadcast too short", func(c *Config) { c.Room.Broadcast = Duration(time.Millisecond) }, false},
+		{"no countdown", func(c *Config) { c.Phases.Countdown = 0 }, false},
+		{"unknown car", func(c *Config) { c.Room.Car = "tank" }, false},
+		{"configured car", func(c *Config) { c.Room.Car = "kart"; c.Classes = []player.CarSpec{kart} }, true},
+		{"undrivable car", func(c *Config) { c.Classes = []player.CarSpec{{Class: "kart", Wheelbase: 30}} }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(&cfg)
+
+			err := cfg.Validate()
+			if (err == nil) != tt.valid {
+				t.Errorf("got %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+var kart = player.CarSpec{Class: "kart", Wheelbase: 30, Mass: 0.5, Traction: 0.2, EnginePower: 6}
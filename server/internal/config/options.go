@@ -0,0 +1,123 @@
+package config
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// option is a setting that can be given as flag and environment variable
+type option struct {
+	name  string
+	usage string
+	value func(*Config) flag.Value // field of the configuration the option sets
+}
+
+var options = []option{
+	{"addr", "address to listen on", func(c *Config) flag.Value { return (*stringValue)(&c.Addr) }},
+	{"tls-cert", "certificate file to serve TLS with", func(c *Config) flag.Value { return (*stringValue)(&c.TLSCert) }},
+	{"tls-key", "private key file of the TLS certificate", func(c *Config) flag.Value { return (*stringValue)(&c.TLSKey) }},
+	{"origins", "comma-separated hosts of the pages the game can be played from", func(c *Config) flag.Value { return (*listValue)(&c.Origins) }},
+	{"tracks", "directory of track files to race on in rotation instead of generated tracks", func(c *Config) flag.Value { return (*stringValue)(&c.Tracks) }},
+	{"replays", "directory to save replays of finished races to", func(c *Config) flag.Value { return (*stringValue)(&c.Replays) }},
+	{"results", "directory to save the standings of finished races to", func(c *Config) flag.Value { return (*stringValue)(&c.Results) }},
+	{"shutdown", "time to finish up games and connections before exiting on SIGTERM", func(c *Config) flag.Value { return (*Duration)(&c.Shutdown) }},
+
+	{"laps", "laps of a race", func(c *Config) flag.Value { return (*intValue)(&c.Room.Laps) }},
+	{"checkpoints", "checkpoints of a lap", func(c *Config) flag.Value { return (*intValue)(&c.Room.Checkpoints) }},
+	{"ghost", "let cars drive through each other", func(c *Config) flag.Value { return (*boolValue)(&c.Room.Ghost) }},
+	{"walls", "let cars bounce off the edge of the track", func(c *Config) flag.Value { return (*boolValue)(&c.Room.Walls) }},
+	{"tick", "simulated time of a game cycle", func(c *Config) flag.Value { return (*Duration)(&c.Room.Tick) }},
+	{"broadcast", "time between two updates sent to the clients (defaults to the tick)", func(c *Config) flag.Value { return (*Duration)(&c.Room.Broadcast) }},
+	{"car", "car class players drive until they pick one", func(c *Config) flag.Value { return (*stringValue)(&c.Room.Car) }},
+
+	{"countdown", "time until a race starts", func(c *Config) flag.Value { return (*Duration)(&c.Phases.Countdown) }},
+	{"closedown", "time until a race ends after the first player finished", func(c *Config) flag.Value { return (*Duration)(&c.Phases.Closedown) }},
+	{"rest", "time the bestlist is shown before the next race", func(c *Config) flag.Value { return (*Duration)(&c.Phases.Rest) }},
+}
+
+// find returns the option of the flag name
+func find(name string) (option, bool) {
+	for _, o := range options {
+		if o.name == name {
+			return o, true
+		}
+	}
+
+	return option{}, false
+}
+
+// env returns the environment variable of the flag name (e.g. `tls-cert` is SENNAI_TLS_CERT)
+func env(name string) string {
+	return "SENNAI_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+type stringValue string
+
+func (s *stringValue) String() string { return string(*s) }
+
+func (s *stringValue) Set(v string) error {
+	*s = stringValue(v)
+	return nil
+}
+
+type intValue int
+
+func (i *intValue) String() string { return strconv.Itoa(int(*i)) }
+
+func (i *intValue) Set(v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+
+	*i = intValue(n)
+	return nil
+}
+
+type boolValue bool
+
+func (b *boolValue) String() string { return strconv.FormatBool(bool(*b)) }
+
+func (b *boolValue) Set(v string) error {
+	ok, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+
+	*b = boolValue(ok)
+	return nil
+}
+
+// IsBoolFlag allows `-ghost` instead of `-ghost=true`
+func (b *boolValue) IsBoolFlag() bool { return true }
+
+// listValue is a comma-separated list
+type listValue []string
+
+func (l *listValue) String() string { return strings.Join(*l, ",") }
+
+func (l *listValue) Set(v string) error {
+	*l = nil
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+
+	return nil
+}
+
+func (d *Duration) String() string { return time.Duration(*d).String() }
+
+// Set parses the duration (e.g. `30ms`)
+func (d *Duration) Set(v string) error {
+	n, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(n)
+	return nil
+}
@@ -5,15 +5,31 @@ import (
 	"net/http"
 )
 
-// ServeDebug can trigger game methods via http for debug purposes
-func ServeDebug(g *Game, w http.ResponseWriter, r *http.Request) {
+// ServeDebug can trigger game methods via http for debug purposes.
+// The game is picked by the `room` query parameter
+func ServeDebug(l *Lobby, w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("room")
+	if name == "" {
+		name = DefaultRoom
+	}
+
+	g, ok := l.Get(name)
+	if !ok {
+		http.Error(w, "unknown room: "+name, http.StatusNotFound)
+		return
+	}
+
 	for k := range r.URL.Query() {
 
 		switch k {
+		case "room":
+			continue
 		case "countdown":
-			g.Countdown()
+			g.do(g.countdown)
 		case "closedown":
-			g.Closedown()
+			g.do(g.closedown)
+		case "bot":
+			g.AddBot("Bot", Follower{Lookahead: 8})
 		default:
 			fmt.Println("unknown key: " + k)
 		}
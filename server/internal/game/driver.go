@@ -0,0 +1,66 @@
+package game
+
+import (
+	"gitlab.com/resamvi/sennai/internal/player"
+	"gitlab.com/resamvi/sennai/internal/sensor"
+	"gitlab.com/resamvi/sennai/internal/track"
+	"gitlab.com/resamvi/sennai/pkg/math"
+)
+
+// Observation is the state of the game as seen by a driver
+type Observation struct {
+	Self    player.Player   // the player controlled by the driver
+	Sensors sensor.Reading  // what Self perceives of the track
+	Players []player.Player // every player in the game (including Self)
+	Track   track.Track
+	Phase   Phase
+}
+
+// Driver controls a server-side player (i.e. a bot).
+// Drive is called exactly once per game cycle in which players can move
+// and the returned input is applied in the very same cycle
+type Driver interface {
+	Drive(obs Observation) player.Input
+}
+
+// DriverFunc is an adapter to allow the use of ordinary functions as drivers
+type DriverFunc func(obs Observation) player.Input
+
+// Drive calls f(obs)
+func (f DriverFunc) Drive(obs Observation) player.Input {
+	return f(obs)
+}
+
+// Follower is a simple driver that keeps its throttle down
+// and steers towards the center line a few points ahead
+type Follower struct {
+	Lookahead int // how many points of the center line to look ahead
+}
+
+// Drive steers towards the point of the center line
+// that is `Lookahead` points further than the nearest one
+func (f Follower) Drive(obs Observation) player.Input {
+	center := obs.Track.Center
+	if len(center) == 0 {
+		return player.Input{}
+	}
+
+	pos := math.Point{X: obs.Self.X, Y: obs.Self.Y}
+
+	nearest := 0
+	for i, p := range center {
+		if pos.DistanceTo(p) < pos.DistanceTo(center[nearest]) {
+			nearest = i
+		}
+	}
+
+	target := center[(nearest+f.Lookahead)%len(center)]
+	angle := math.NormalizeAngle(math.VectorFromTo(pos, target).Angle() - obs.Self.Rotation)
+
+	const deadzone = 5.0
+	return player.Input{
+		Up:    true,
+		Left:  angle < -deadzone,
+		Right: angle > deadzone,
+	}
+}
@@ -0,0 +1,44 @@
+package game
+
+import (
+	"testing"
+
+	"gitlab.com/resamvi/sennai/internal/player"
+	"gitlab.com/resamvi/sennai/internal/track"
+)
+
+func TestDriverLockstep(t *testing.T) {
+	g := NewHeadless(track.NewFromSeed(2), Settings{})
+
+	calls := 0
+	g.AddBot("Counter", DriverFunc(func(obs Observation) player.Input {
+		calls++
+		return player.Input{Up: true}
+	}))
+
+	g.phase = RACE
+	for i := 0; i < 10; i++ {
+		g.Update()
+	}
+
+	if calls != 10 {
+		t.Errorf("got %d decisions, want 10", calls)
+	}
+}
+
+func TestFollower(t *testing.T) {
+	g := NewHeadless(track.NewFromSeed(2), Settings{})
+
+	id := g.AddBot("Follower", Follower{Lookahead: 8})
+
+	g.phase = RACE
+	for i := 0; i < 300; i++ {
+		g.Update()
+	}
+
+	for _, p := range g.Players() {
+		if p.ID == id && p.Progress == 0 {
+			t.Errorf("follower did not make any progress")
+		}
+	}
+}
@@ -3,12 +3,21 @@
 package game
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
 	"gitlab.com/resamvi/sennai/internal/player"
 	"gitlab.com/resamvi/sennai/internal/protocol"
+	"gitlab.com/resamvi/sennai/internal/replay"
+	"gitlab.com/resamvi/sennai/internal/sensor"
+	"gitlab.com/resamvi/sennai/internal/timing"
 	"gitlab.com/resamvi/sennai/internal/track"
 	"gitlab.com/resamvi/sennai/pkg/math"
 	"gitlab.com/resamvi/sennai/pkg/pubsub"
@@ -34,69 +43,274 @@ const (
 	FINISHED
 )
 
+// Default durations of the phases
 const (
-	// time until race start -  (countdownstart of e.g. 99 starts counting from 9.9s)
-	countdownstart = 70
+	// time until race start (counted down in deci-seconds)
+	countdownlength = 7 * time.Second
 
-	// time until race finish after first reached end (in deci-seconds)
-	closedownstart = 50
+	// time until race finish after first reached end (counted down in deci-seconds)
+	closedownlength = 5 * time.Second
 
-	// time (in s) in which the bestlist is displayed and until next race starts
-	restperiodlength = 6
+	// time in which the bestlist is displayed and until next race starts (counted down in seconds)
+	restperiodlength = 6 * time.Second
 )
 
-// Game maintains a reference to all connected players
+// Game maintains a reference to all connected players.
+//
+// The state of a game is owned by a single goroutine: the game loop (see Run), or the caller of
+// Update for headless games. Every exported method hands its work to the owner as a command (see do)
+// so connections, countdowns and the lobby never touch the state concurrently
 type Game struct {
-	players      sync.Map
-	clock        *time.Ticker
+	players      map[int]*player.Player
+	bots         map[int]Driver
 	events       *pubsub.Pubsub
 	track        track.Track
+	layout       sensor.Layout // sensor measurements are taken against
+	course       timing.Course
+	settings     Settings
 	phase        Phase
-	starttime    time.Time
 	roundsplayed int
+	sensors      sensor.Config
+	quit         chan struct{}
+	commands     chan func()    // mutations and queries run by the game loop
+	done         chan struct{}  // closed when the game loop ended
+	mu           sync.Mutex     // serializes commands once the game loop ended
+	saving       sync.WaitGroup // replays that are being written
+	headless     bool           // headless games are advanced manually by calling Update and skip every countdown
+	frames       int            // game cycles that passed since the race started (i.e. the race time in ticks)
+	ticks        int            // game cycles that passed since the game was created
+	recorder     *replay.Recorder
 }
 
-// New creates a new game
-func New() *Game {
+// Settings configure a game
+type Settings struct {
+	Tracks      track.Source  // supplies the track of every race
+	Replays     string        // directory replays of finished races are saved to (empty to not record races)
+	Results     string        // directory the standings of finished races are saved to (empty to not keep them)
+	Laps        int           // laps to complete a race (defaults to 1)
+	Checkpoints int           // gates between start and finish line per lap (defaults to 8)
+	Ghost       bool          // cars drive through each other instead of colliding
+	Walls       bool          // track sides are solid walls instead of sand
+	Tick        time.Duration // simulated time of a game cycle (defaults to 30ms)
+	Broadcast   time.Duration // time between two updates sent to the clients (defaults to Tick)
+	Countdown   time.Duration // time until the race starts (defaults to 7s)
+	Closedown   time.Duration // time the race continues after the first player finished (defaults to 5s)
+	Rest        time.Duration // time the bestlist is shown until the next race (defaults to 6s)
+	Car         string        // car class players drive until they pick one (defaults to standard)
+}
+
+// withDefaults fills in the unset settings
+func (s Settings) withDefaults() Settings {
+	if s.Laps <= 0 {
+		s.Laps = 1
+	}
+
+	if s.Checkpoints <= 0 {
+		s.Checkpoints = 8
+	}
+
+	if s.Tick <= 0 {
+		s.Tick = player.Step
+	}
+
+	if s.Broadcast <= 0 {
+		s.Broadcast = s.Tick
+	}
+
+	if s.Countdown <= 0 {
+		s.Countdown = countdownlength
+	}
+
+	if s.Closedown <= 0 {
+		s.Closedown = closedownlength
+	}
+
+	if s.Rest <= 0 {
+		s.Rest = restperiodlength
+	}
+
+	return s
+}
+
+// Topics of the game events that are published periodically so consumers
+// (e.g. a metrics exporter or a spectator stream) can subscribe to them typed
+var (
+	Updates   = pubsub.Topic[[]player.Player]{Name: protocol.UPDATE}
+	Bestlists = pubsub.Topic[[]Standing]{Name: protocol.BESTLIST}
+)
+
+// maxcatchup is the most game cycles run at once to catch up after the game loop fell behind
+const maxcatchup = 5
+
+// New creates a new game configured by the settings
+func New(settings Settings) *Game {
+	settings = settings.withDefaults()
+	t := settings.Tracks.Next()
+
 	return &Game{
-		players:      sync.Map{},
-		clock:        time.NewTicker(30 * time.Millisecond),
+		players:      make(map[int]*player.Player),
+		bots:         make(map[int]Driver),
 		events:       pubsub.New(),
-		track:        track.New(),
+		track:        t,
+		layout:       sensor.NewLayout(t),
+		course:       timing.NewCourse(t, settings.Checkpoints, settings.Laps),
+		settings:     settings,
 		phase:        STARTING,
 		roundsplayed: 0,
+		sensors:      sensor.Default,
+		quit:         make(chan struct{}),
+		commands:     make(chan func()),
+		done:         make(chan struct{}),
+	}
+}
+
+// NewHeadless creates a game on the given track that is not driven by a clock.
+// Every call to Update advances it by exactly one game cycle and phases
+// that usually wait for a countdown to finish are skipped.
+// The track source of the settings is not used and the game must not be used by multiple goroutines
+func NewHeadless(t track.Track, settings Settings) *Game {
+	settings = settings.withDefaults()
+
+	return &Game{
+		players:  make(map[int]*player.Player),
+		bots:     make(map[int]Driver),
+		events:   pubsub.New(),
+		track:    t,
+		layout:   sensor.NewLayout(t),
+		course:   timing.NewCourse(t, settings.Checkpoints, settings.Laps),
+		settings: settings,
+		phase:    STARTING,
+		sensors:  sensor.Default,
+		quit:     make(chan struct{}),
+		headless: true,
 	}
 }
 
 // Run starts listening to client connection requests
-func (g *Game) Run() {
+// until the game is stopped or the context is done.
+// The game advances in fixed steps of the tick duration no matter how
+// punctual the clock is (by catching up missed game cycles) while
+// clients are updated at the separate broadcast rate.
+// In between, the commands of the other goroutines are run.
+//
+// When the context is done the current race is aborted, its replay saved
+// and clients are told the server shuts down before Run returns.
+// Every subscription to the game events ends with Run (see pubsub.ErrClosed)
+func (g *Game) Run(ctx context.Context) {
+	defer close(g.done)
+	defer g.events.Close()
+
+	clock := time.NewTicker(g.settings.Tick)
+	defer clock.Stop()
+
+	broadcast := time.NewTicker(g.settings.Broadcast)
+	defer broadcast.Stop()
+
+	var accumulator time.Duration
+	last := time.Now()
+
 	for {
 		select {
-		case <-g.clock.C:
+		case <-g.quit:
+			g.saveReplay()
+			return
+
+		case <-ctx.Done():
+			g.shutdown()
+			return
+
+		case command := <-g.commands:
+			command()
+
+		case now := <-clock.C:
+			accumulator += now.Sub(last)
+			last = now
 
 			// Do not run the game if no players are online
-			if len(g.Players()) == 0 {
+			if len(g.players) == 0 {
+				accumulator = 0
 				continue
 			}
 
-			g.Update()
+			for steps := 0; accumulator >= g.settings.Tick; steps++ {
+				if steps == maxcatchup {
+					accumulator = 0
+					break
+				}
+
+				g.Update()
+				accumulator -= g.settings.Tick
+			}
+
+		case <-broadcast.C:
+			if len(g.players) == 0 {
+				continue
+			}
 
+			// Both are sent again every broadcast so a client that is behind only needs the newest
 			if g.phase == FINISHED {
-				g.events.Publish(protocol.BESTLIST, g.Bestlist())
+				Bestlists.PublishLatest(g.events, g.standings())
 			} else {
-				g.events.Publish(protocol.UPDATE, g.Players())
+				Updates.PublishLatest(g.events, g.list())
 			}
 		}
 	}
 }
 
+// Stop ends the game loop started by Run
+func (g *Game) Stop() {
+	close(g.quit)
+}
+
+// Done is closed when the game loop started by Run ended
+func (g *Game) Done() <-chan struct{} {
+	return g.done
+}
+
+// shutdown aborts the race (sending and saving the standings so far), waits until every replay
+// and result is written and tells the clients the server is going away
+func (g *Game) shutdown() {
+	if g.phase == RACE || g.phase == CLOSING {
+		g.phase = FINISHED
+		g.events.Publish(protocol.BESTLIST, g.standings())
+		g.saveResults()
+	}
+
+	g.saveReplay()
+	g.saving.Wait()
+
+	g.events.Publish(protocol.SHUTDOWN, "server is shutting down")
+	log.Println("Game shut down")
+}
+
+// do runs the command on the goroutine owning the game state and waits until it is done.
+// Commands must not call exported methods of the game themselves
+func (g *Game) do(command func()) {
+	if g.headless {
+		command()
+		return
+	}
+
+	done := make(chan struct{})
+	select {
+	case g.commands <- func() { command(); close(done) }:
+		<-done
+	case <-g.done:
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		command()
+	}
+}
+
 // Update calculates the next frame given from the previous state and the registered inputs
 // Consider a call to Update a heart beat with each call being a game cycle
 func (g *Game) Update() {
+	g.ticks++
+
 	if g.phase == STARTING {
-		g.ResetAll()
-		g.Countdown()
-		g.phase = COUNTDOWN
+		g.resetAll()
+		g.frames = 0
+		g.countdown()
 	}
 
 	// Don't move players in these phases
@@ -104,59 +318,209 @@ func (g *Game) Update() {
 		return
 	}
 
-	g.players.Range(func(k interface{}, v interface{}) bool {
-		player := v.(*player.Player)
+	g.frames++
+	g.drive()
 
-		circle := math.Circle{X: player.X, Y: player.Y, Radius: track.Trackwidth}
+	players := g.sorted()
+	if g.recorder != nil {
+		g.recorder.Capture(copies(players))
+
+		if g.recorder.Full() {
+			log.Println("Replay reached its maximum length of", replay.MaxDuration)
+			g.saveReplay()
+		}
+	}
+
+	from := make([]math.Point, len(players))
+	for i, p := range players {
+		from[i] = math.Point{X: p.X, Y: p.Y}
+	}
+
+	simulate(players, g.track, g.settings.Ghost, g.settings.Walls, g.settings.Tick)
+
+	for i, player := range players {
+		to := math.Point{X: player.X, Y: player.Y}
+
+		// Let clients know which of their inputs are part of this state
+		player.LastSeq = player.Input.Seq
+		player.Tick = g.ticks
+
+		g.course.Cross(&player.Timing, from[i], to, g.elapsed())
+		player.Progress = g.course.Progress(player.Timing, to)
+
+		if g.phase == RACE && player.Timing.Finished {
+			g.closedown()
+		}
+
+		if player.FinishTime == 0 && player.Timing.Finished {
+			player.FinishTime = g.elapsed()
+		}
+	}
+}
+
+// simulate moves every player by one game cycle of duration dt on the track according to their inputs
+// and lets them collide with each other unless they are ghosts (and with the track sides if they are walls).
+// It must only depend on its arguments so races can be re-simulated from replays
+func simulate(players []*player.Player, t track.Track, ghost, walls bool, dt time.Duration) {
+	var sides []math.Segment
+	if walls {
+		sides = t.Walls()
+	}
+
+	for _, player := range players {
+		from := math.Point{X: player.X, Y: player.Y}
+
+		circle := math.Circle{X: player.X, Y: player.Y, Radius: t.Width}
 		pointsTouching := make([]int, 0)
-		for i, p := range g.track.Center {
+		for i, p := range t.Center {
 			if circle.Contains(p) {
 				pointsTouching = append(pointsTouching, i)
 			}
 		}
-		player.Update(pointsTouching)
+		player.Update(pointsTouching, dt)
 
-		if g.phase == RACE && player.Progress == 100 {
-			g.Closedown()
-			g.phase = CLOSING
+		if walls {
+			player.HitWalls(from, sides)
 		}
+	}
 
-		if player.FinishTime == 0 && player.Progress == 100 {
-			player.FinishTime = time.Since(g.starttime)
-		}
+	if ghost {
+		return
+	}
 
-		return true
-	})
+	for i := 0; i < len(players); i++ {
+		for j := i + 1; j < len(players); j++ {
+			player.Collide(players[i], players[j])
+		}
+	}
 }
 
 // Connect registers a new connection to the game.
 // It returns the assigned playerID of this connection as well as
 // a channel to receive the latest game events that occured
 func (g *Game) Connect() (int, *pubsub.Subscription) {
-	id := -1
-	for i := 0; ; i++ {
-		if _, ok := g.players.Load(i); !ok {
-			id = i
-			break
+	var id int
+	g.do(func() {
+		id = g.spawn()
+	})
+	sub := g.events.Subscribe()
+
+	log.Println("New Connection with id:", id)
+	return id, sub
+}
+
+// Join lets a player join that is not connected to any client (e.g. an agent of a simulation).
+// It returns the assigned playerID
+func (g *Game) Join(name string) int {
+	var id int
+	g.do(func() {
+		id = g.spawn()
+		g.rename(name, id)
+	})
+
+	return id
+}
+
+// Spectate subscribes to the game events (that pass the filters, e.g. see pubsub.Topics)
+// without joining the race. Spectators are not counted as players
+func (g *Game) Spectate(filters ...pubsub.Filter) *pubsub.Subscription {
+	log.Println("New Spectator")
+	return g.events.Subscribe(filters...)
+}
+
+// Watch subscribes to a topic of the game events without joining the race (e.g. see Updates)
+func Watch[T any](g *Game, topic pubsub.Topic[T], filters ...pubsub.Filter) *pubsub.Typed[T] {
+	log.Println("New Spectator of", topic.Name)
+	return topic.Subscribe(g.events, filters...)
+}
+
+// Events returns the counters of the events sent to the clients
+func (g *Game) Events() pubsub.Stats {
+	return g.events.Stats()
+}
+
+// Unspectate cleans up after a spectator leaves
+func (g *Game) Unspectate(sub *pubsub.Subscription) {
+	sub.Unsubscribe()
+	log.Println("Spectator left")
+}
+
+// AddBot lets a server-side player join the game whose inputs are decided by the driver.
+// It returns the assigned playerID of the bot
+func (g *Game) AddBot(name string, driver Driver) int {
+	var id int
+	g.do(func() {
+		id = g.spawn()
+		g.bots[id] = driver
+		g.rename(name, id)
+	})
+
+	log.Println("New Bot with id:", id)
+	return id
+}
+
+// RemoveBot lets a server-side player leave the game
+func (g *Game) RemoveBot(id int) {
+	removed := false
+	g.do(func() {
+		if _, ok := g.bots[id]; !ok {
+			return
 		}
+
+		delete(g.bots, id)
+		delete(g.players, id)
+		g.events.Publish(protocol.LEAVE, id)
+		removed = true
+	})
+
+	if removed {
+		log.Println("Removed bot id:", id)
 	}
+}
 
-	// TODO: Calculate start position here
-	// TODO: Create progress slice here
+// spawn places a new player on the grid and returns its id
+func (g *Game) spawn() int {
+	id := 0
+	for g.players[id] != nil {
+		id++
+	}
 
-	player := player.New(id, g.track.Center[10], g.track.Center[11], len(g.track.Center))
-	g.players.Store(id, &player)
+	slot := g.track.Slot(id)
+	p := player.New(id, slot.Position, slot.Rotation)
+	if spec, ok := player.Class(g.settings.Car); ok {
+		p.Car = spec
+	}
+	g.players[id] = &p
 
-	sub := g.events.Subscribe()
+	return id
+}
 
-	log.Println("New Connection with id:", id)
-	return id, sub
+// drive asks every bot for its input of this game cycle
+func (g *Game) drive() {
+	players := g.list()
+
+	for id, driver := range g.bots {
+		self, ok := g.players[id]
+		if !ok {
+			continue
+		}
+
+		self.Input = driver.Drive(Observation{
+			Self:    *self,
+			Sensors: sensor.Read(*self, g.layout, g.sensors),
+			Players: players,
+			Track:   g.track,
+			Phase:   g.phase,
+		})
+	}
 }
 
 // Disconnect cleans up after client leaves
 func (g *Game) Disconnect(id int, sub *pubsub.Subscription) {
-	g.players.Delete(id)
-	g.events.Publish(protocol.LEAVE, id)
+	g.do(func() {
+		delete(g.players, id)
+		g.events.Publish(protocol.LEAVE, id)
+	})
 	sub.Unsubscribe()
 
 	log.Println("Disonnected client id:", id)
@@ -164,81 +528,222 @@ func (g *Game) Disconnect(id int, sub *pubsub.Subscription) {
 
 // SetPlayerInput is used when an input command from a player
 // is registered and applied on the next game cycle
-func (g *Game) SetPlayerInput(input player.Input, playerID int) {
-	p, ok := g.players.Load(playerID)
-
-	if !ok {
-		log.Fatalf("setting input for unknown playerID: %d", playerID)
-	}
+func (g *Game) SetPlayerInput(input player.Input, playerID int) error {
+	var err error
+	g.do(func() {
+		p, ok := g.players[playerID]
+		if !ok {
+			err = fmt.Errorf("setting input for unknown playerID: %d", playerID)
+			return
+		}
 
-	new := p.(*player.Player)
-	new.Input = input // TODO: Should be done by player
+		p.Input = input // TODO: Should be done by player
+	})
 
-	g.players.Store(playerID, new)
+	return err
 }
 
 // SetPlayerName is used when the player has chosen a name
 // that is to be displayed on his nametag
-func (g *Game) SetPlayerName(name string, playerID int) {
-	p, ok := g.players.Load(playerID)
+func (g *Game) SetPlayerName(name string, playerID int) error {
+	var err error
+	g.do(func() {
+		err = g.rename(name, playerID)
+	})
 
+	return err
+}
+
+// rename sets the name of a player and lets everyone know
+func (g *Game) rename(name string, playerID int) error {
+	p, ok := g.players[playerID]
+	if !ok {
+		return fmt.Errorf("setting name for unknown playerID: %d", playerID)
+	}
+
+	p.Name = name
+	g.events.Publish(protocol.JOIN, joined{Player: *p, Car: p.Car})
+	return nil
+}
+
+// joined is the payload of JOIN. Unlike updates it carries the car spec
+// so clients set up the car of the new player the same way as the ones sent with INIT
+type joined struct {
+	player.Player
+	Car player.CarSpec `json:"car"`
+}
+
+// SetPlayerCar is used when the player has chosen the class of car to drive
+func (g *Game) SetPlayerCar(class string, playerID int) error {
+	spec, ok := player.Class(class)
 	if !ok {
-		log.Fatalf("setting name for unknown playerID: %d", playerID)
+		return fmt.Errorf("unknown car class: %s", class)
 	}
 
-	modified := p.(*player.Player)
-	modified.Name = name
+	var err error
+	g.do(func() {
+		p, ok := g.players[playerID]
+		if !ok {
+			err = fmt.Errorf("setting car for unknown playerID: %d", playerID)
+			return
+		}
 
-	g.players.Store(playerID, p)
-	g.events.Publish(protocol.JOIN, modified)
+		p.Car = spec
+	})
+
+	return err
 }
 
-// Countdown declares the remaining seconds until the race begins and players can move
+// Specs returns the car spec of every player by ID
+func (g *Game) Specs() map[int]player.CarSpec {
+	result := make(map[int]player.CarSpec)
+	g.do(func() {
+		for id, p := range g.players {
+			result[id] = p.Car
+		}
+	})
+
+	return result
+}
+
+// countdown declares the remaining seconds until the race begins and players can move
 // Transitions game from phase COUNTDOWN -> RACE
-func (g *Game) Countdown() {
-	g.startCount(countdownstart, COUNTDOWN, RACE, 100*time.Millisecond, func() {
-		g.starttime = time.Now()
+func (g *Game) countdown() {
+	g.startCount(int(g.settings.Countdown/(100*time.Millisecond)), COUNTDOWN, RACE, 100*time.Millisecond, func() {
+		g.saveReplay() // of a race that was restarted before it ended
+		if g.settings.Replays != "" {
+			g.recorder = replay.NewRecorder(g.track, g.settings.Ghost, g.settings.Walls, g.settings.Tick)
+		}
 	}, protocol.COUNTDOWN)
 }
 
-// Closedown declares the remaining time the race continues after the first player has crossed the finish line
+// closedown declares the remaining time the race continues after the first player has crossed the finish line
 // Transitions game from phase CLOSING -> FINISHED
-func (g *Game) Closedown() {
-	g.startCount(closedownstart, CLOSING, FINISHED, 100*time.Millisecond, g.Restperiod, protocol.CLOSEDOWN)
+func (g *Game) closedown() {
+	g.startCount(int(g.settings.Closedown/(100*time.Millisecond)), CLOSING, FINISHED, 100*time.Millisecond, func() {
+		g.saveReplay()
+		g.saveResults()
+		g.restperiod()
+	}, protocol.CLOSEDOWN)
 }
 
-// Restperiod declares the remaining time the bestlist is shown and a new race will begin
+// restperiod declares the remaining time the bestlist is shown and a new race will begin
 // Transitions game from phase FINISHED -> STARTING
-func (g *Game) Restperiod() {
-	g.startCount(restperiodlength, FINISHED, STARTING, 1*time.Second, g.ChangeTrack, protocol.REST)
+func (g *Game) restperiod() {
+	g.startCount(int(g.settings.Rest/time.Second), FINISHED, STARTING, 1*time.Second, g.changeTrack, protocol.REST)
 }
 
 // Starts a countdown starting at `startAt` and going down to zero. While countdown the game's phase is in `currentPhase` and
 // will be at `endPhase` after the countdown completes. On completion `onFinish` will be called. All clients will be notified of the count
-// labelled by the protocol prefix `publishType`
+// labelled by the protocol prefix `publishType`.
+// The countdown only keeps the time, every count is a command run by the game loop
 func (g *Game) startCount(startAt int, currentPhase Phase, endPhase Phase, tickInterval time.Duration, onFinish func(), publishType string) {
+	if g.headless {
+		g.phase = endPhase
+		return
+	}
+
 	count := startAt
 	g.phase = currentPhase
 
 	go func() {
-		for range time.Tick(tickInterval) {
-			count--
-
-			if count < 0 {
-				g.phase = endPhase
-				onFinish()
-				break
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+
+		for finished := false; !finished; {
+			select {
+			case <-g.done:
+				return
+			case <-ticker.C:
 			}
 
-			g.events.Publish(publishType, count)
+			g.do(func() {
+				count--
+
+				if count < 0 {
+					g.phase = endPhase
+					onFinish()
+					finished = true
+					return
+				}
+
+				g.events.Publish(publishType, count)
+			})
 		}
 	}()
 }
 
-// ChangeTrack changes the track of the game
-func (g *Game) ChangeTrack() {
-	g.track = track.New()
+// saveReplay stops recording and writes the replay of the race to the replay directory
+func (g *Game) saveReplay() {
+	rec := g.recorder
+	if rec == nil {
+		return
+	}
+	g.recorder = nil
+
+	name := fmt.Sprintf("%s-%d.replay", time.Now().Format("20060102-150405"), g.track.Seed)
+	path := filepath.Join(g.settings.Replays, name)
+
+	g.saving.Add(1)
+	go func() {
+		defer g.saving.Done()
+
+		err := replay.Save(path, rec.Replay())
+		if err != nil {
+			log.Println("REPLAY: " + err.Error())
+			return
+		}
+
+		log.Println("Saved replay:", path)
+	}()
+}
+
+// saveResults writes the standings of the race to the results directory.
+// They are kept apart from the replay so they are saved even if races are not recorded
+func (g *Game) saveResults() {
+	if g.settings.Results == "" {
+		return
+	}
+
+	name := fmt.Sprintf("%s-%d.json", time.Now().Format("20060102-150405"), g.track.Seed)
+	path := filepath.Join(g.settings.Results, name)
+	list := g.standings()
+
+	g.saving.Add(1)
+	go func() {
+		defer g.saving.Done()
+
+		data, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			log.Println("RESULTS: " + err.Error())
+			return
+		}
+
+		err = ioutil.WriteFile(path, data, 0644)
+		if err != nil {
+			log.Println("RESULTS: " + err.Error())
+			return
+		}
+
+		log.Println("Saved results:", path)
+	}()
+}
+
+// elapsed returns the race time that has passed.
+// It is counted in game cycles so that hiccups of the server do not change lap times
+func (g *Game) elapsed() time.Duration {
+	return time.Duration(g.frames) * g.settings.Tick
+}
+
+// changeTrack changes the track of the game
+func (g *Game) changeTrack() {
+	g.saveReplay() // of a race that was aborted
+	g.track = g.settings.Tracks.Next()
+	g.layout = sensor.NewLayout(g.track)
+	g.course = timing.NewCourse(g.track, g.settings.Checkpoints, g.settings.Laps)
 	g.events.Publish(protocol.TRACK, g.track)
+
+	log.Printf("New track %q with seed: %d (preset %q)\n", g.track.Name, g.track.Seed, g.track.Preset)
 }
 
 // Standing is an entry of the bestlist
@@ -246,52 +751,142 @@ type Standing struct {
 	Name       string  `json:"name"`
 	FinishTime int64   `json:"finishTime"`
 	Progress   float64 `json:"progress"`
+	Laps       int     `json:"laps"`
+	BestLap    int64   `json:"bestLap"`
+	WallHits   int     `json:"wallHits"`
 }
 
 // Bestlist returns the sorted and viewable race standings of this round
 // has to be sorted and formatted by the client
 func (g *Game) Bestlist() []Standing {
-	list := make([]Standing, 0)
-	g.players.Range(func(k interface{}, v interface{}) bool {
-		player := v.(*player.Player)
+	var list []Standing
+	g.do(func() {
+		list = g.standings()
+	})
 
-		standing := Standing{
+	return list
+}
+
+// standings returns the standing of every player
+func (g *Game) standings() []Standing {
+	list := make([]Standing, 0)
+	for _, player := range g.players {
+		list = append(list, Standing{
 			Name:       player.Name,
 			FinishTime: player.FinishTime.Milliseconds(),
 			Progress:   player.Progress,
-		}
+			Laps:       player.Timing.Lap,
+			BestLap:    player.Timing.BestLap.Milliseconds(),
+			WallHits:   player.WallHits,
+		})
+	}
 
-		list = append(list, standing)
+	return list
+}
 
-		return true
+// Course returns the gates of the current track
+func (g *Game) Course() timing.Course {
+	var course timing.Course
+	g.do(func() {
+		course = g.course
 	})
 
-	return list
+	return course
 }
 
 // Track returns the currently used track layout
 func (g *Game) Track() track.Track {
-	return g.track
+	var t track.Track
+	g.do(func() {
+		t = g.track
+	})
+
+	return t
+}
+
+// Layout returns what sensors measure of the current track (see sensor.Read)
+func (g *Game) Layout() sensor.Layout {
+	var l sensor.Layout
+	g.do(func() {
+		l = g.layout
+	})
+
+	return l
+}
+
+// resetAll resets every player back to the start
+func (g *Game) resetAll() {
+	for _, player := range g.players {
+		slot := g.track.Slot(player.ID)
+		player.Reset(slot.Position, slot.Rotation)
+	}
 }
 
-// ResetAll resets every player back to the start
-func (g *Game) ResetAll() {
-	g.players.Range(func(k interface{}, v interface{}) bool {
-		player := v.(*player.Player)
-		player.Reset(g.track.Center[10], g.track.Center[11], len(g.track.Center))
-		// TODO: Start Point should be part of track
-		return true
+// sorted returns references to every player ordered by their ID
+func (g *Game) sorted() []*player.Player {
+	result := make([]*player.Player, 0, len(g.players))
+	for _, p := range g.players {
+		result = append(result, p)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
 	})
+
+	return result
+}
+
+// copies dereferences every player
+func copies(players []*player.Player) []player.Player {
+	result := make([]player.Player, len(players))
+	for i, p := range players {
+		result[i] = *p
+	}
+
+	return result
+}
+
+// Player returns the current state of a single player
+func (g *Game) Player(id int) (player.Player, bool) {
+	var result player.Player
+	ok := false
+	g.do(func() {
+		var p *player.Player
+		p, ok = g.players[id]
+		if ok {
+			result = *p
+		}
+	})
+
+	return result, ok
+}
+
+// Phase returns the current phase of the game
+func (g *Game) Phase() Phase {
+	var phase Phase
+	g.do(func() {
+		phase = g.phase
+	})
+
+	return phase
 }
 
 // Players returns the currently connected clients as a slice
 func (g *Game) Players() []player.Player {
-	result := make([]player.Player, 0)
-	g.players.Range(func(k interface{}, v interface{}) bool {
-		item := *v.(*player.Player)
-		result = append(result, item)
-		return true
+	var result []player.Player
+	g.do(func() {
+		result = g.list()
 	})
 
 	return result
 }
+
+// list returns a copy of every player
+func (g *Game) list() []player.Player {
+	result := make([]player.Player, 0, len(g.players))
+	for _, p := range g.players {
+		result = append(result, *p)
+	}
+
+	return result
+}
@@ -0,0 +1,354 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/resamvi/sennai/internal/player"
+	"gitlab.com/resamvi/sennai/internal/protocol"
+	"gitlab.com/resamvi/sennai/internal/replay"
+	"gitlab.com/resamvi/sennai/internal/sensor"
+	"gitlab.com/resamvi/sennai/internal/track"
+	"gitlab.com/resamvi/sennai/pkg/math"
+)
+
+func TestRaceFinishes(t *testing.T) {
+	g := NewHeadless(track.NewFromSeed(2), Settings{Laps: 2})
+	g.AddBot("Follower", Follower{Lookahead: 8})
+
+	for i := 0; i < 5000 && g.Phase() != FINISHED; i++ {
+		g.Update()
+	}
+
+	if g.Phase() != FINISHED {
+		t.Fatalf("race did not finish")
+	}
+
+	standings := g.Bestlist()
+	if len(standings) != 1 {
+		t.Fatalf("got %d standings, want 1", len(standings))
+	}
+
+	got := standings[0]
+	if got.Laps != 2 || got.Progress != 100 || got.BestLap == 0 || got.FinishTime < 2*got.BestLap {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestCollisions(t *testing.T) {
+	tr := track.NewFromSeed(2)
+	slot := tr.Slot(0)
+
+	tests := []struct {
+		name  string
+		ghost bool
+		apart bool
+	}{
+		{"cars collide", false, true},
+		{"ghosts drive through", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := player.New(0, slot.Position, slot.Rotation)
+			b := player.New(1, math.Point{X: slot.Position.X + 5, Y: slot.Position.Y}, slot.Rotation)
+
+			simulate([]*player.Player{&a, &b}, tr, tt.ghost, false, player.Step)
+
+			// Cars are 30 units wide so their centers are at least that far apart when not overlapping
+			distance := math.VectorFromTo(math.Point{X: a.X, Y: a.Y}, math.Point{X: b.X, Y: b.Y}).Len()
+			if got := distance > 29; got != tt.apart {
+				t.Errorf("got distance %.2f between cars", distance)
+			}
+		})
+	}
+}
+
+func TestWalls(t *testing.T) {
+	tests := []struct {
+		name    string
+		walls   bool
+		offroad bool
+	}{
+		{"sand", false, true},
+		{"walls", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewHeadless(track.NewFromSeed(2), Settings{Walls: tt.walls})
+			id := g.Join("Straight")
+			g.Update()
+			g.SetPlayerInput(player.Input{Up: true}, id)
+
+			offroad := false
+			for i := 0; i < 300; i++ {
+				g.Update()
+				p, _ := g.Player(id)
+				offroad = offroad || p.Offroad()
+			}
+
+			if offroad != tt.offroad {
+				t.Errorf("got offroad %v, want %v", offroad, tt.offroad)
+			}
+
+			p, _ := g.Player(id)
+			if tt.walls != (p.WallHits > 0) {
+				t.Errorf("got %d wall hits", p.WallHits)
+			}
+		})
+	}
+}
+
+func TestTickRate(t *testing.T) {
+	race := func(tick time.Duration) time.Duration {
+		g := NewHeadless(track.NewFromSeed(2), Settings{Tick: tick})
+		g.AddBot("Follower", Follower{Lookahead: 8})
+
+		for i := 0; i < 20000 && g.Phase() != FINISHED; i++ {
+			g.Update()
+		}
+
+		p, _ := g.Player(0)
+		return p.FinishTime
+	}
+
+	want := race(player.Step)
+	if want == 0 {
+		t.Fatalf("race did not finish")
+	}
+
+	tests := []time.Duration{10 * time.Millisecond, 15 * time.Millisecond, 60 * time.Millisecond}
+
+	for _, tick := range tests {
+		t.Run(tick.String(), func(t *testing.T) {
+			got := race(tick)
+
+			// Finish times may only differ by the finer steering of bots at faster tick rates
+			diff := got - want
+			if diff < 0 {
+				diff = -diff
+			}
+
+			if diff > want/20 {
+				t.Errorf("got finish time %v, want about %v", got, want)
+			}
+		})
+	}
+}
+
+func TestInputSeq(t *testing.T) {
+	g := NewHeadless(track.NewFromSeed(2), Settings{})
+	id := g.Join("Player")
+
+	for i := 1; i <= 3; i++ {
+		g.SetPlayerInput(player.Input{Up: true, Seq: uint32(i * 5)}, id)
+		g.Update()
+	}
+
+	p, ok := g.Player(id)
+	if !ok {
+		t.Fatalf("player %d not found", id)
+	}
+
+	if p.LastSeq != 15 || p.Tick != 3 {
+		t.Errorf("got lastSeq %d at tick %d, want 15 at tick 3", p.LastSeq, p.Tick)
+	}
+
+	if err := g.SetPlayerInput(player.Input{Up: true}, id+1); err == nil {
+		t.Errorf("input for unknown player was accepted")
+	}
+}
+
+func TestJoinSpec(t *testing.T) {
+	g := NewHeadless(track.NewFromSeed(2), Settings{})
+	id, sub := g.Connect()
+
+	if err := g.SetPlayerCar(player.Heavy.Class, id); err != nil {
+		t.Fatal(err)
+	}
+	g.SetPlayerName("Senna", id)
+
+	ev, ok := sub.Next()
+	if !ok || ev.Typ != protocol.JOIN {
+		t.Fatalf("got %v, want %s", ev, protocol.JOIN)
+	}
+
+	data, err := json.Marshal(ev.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Name string         `json:"name"`
+		Car  player.CarSpec `json:"car"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Name != "Senna" || got.Car != player.Heavy {
+		t.Errorf("got %s", data)
+	}
+}
+
+// TestConcurrentClients is meant to be run with -race
+func TestConcurrentClients(t *testing.T) {
+	g := New(Settings{Tracks: track.Generator{Config: track.Oval}, Tick: 5 * time.Millisecond})
+	go g.Run(context.Background())
+	defer g.Stop()
+
+	bot := g.AddBot("Bot", Follower{Lookahead: 8})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			id, sub := g.Connect()
+			defer g.Disconnect(id, sub)
+
+			go func() {
+				for {
+					if _, ok := sub.Next(); !ok {
+						return
+					}
+				}
+			}()
+
+			g.SetPlayerName(fmt.Sprintf("Client %d", i), id)
+			g.SetPlayerCar("drift", id)
+
+			for j := 0; j < 100; j++ {
+				g.SetPlayerInput(player.Input{Up: true, Left: j%2 == 0, Seq: uint32(j)}, id)
+
+				g.Players()
+				g.Specs()
+				g.Phase()
+				g.Bestlist()
+				if p, ok := g.Player(id); ok {
+					sensor.Read(p, g.Layout(), sensor.Default)
+				}
+
+				// phase transitions and track changes triggered from outside the loop (e.g. ServeDebug)
+				switch {
+				case i == 0 && j == 20:
+					g.do(g.countdown)
+				case i == 1 && j == 50:
+					g.do(g.changeTrack)
+				case i == 2 && j == 80:
+					g.do(g.closedown)
+				}
+
+				time.Sleep(time.Millisecond)
+			}
+		}(i)
+	}
+
+	sub := g.Spectate()
+	go func() {
+		for {
+			if _, ok := sub.Next(); !ok {
+				return
+			}
+		}
+	}()
+
+	updates := Watch(g, Updates)
+	go func() {
+		for {
+			if _, ok := updates.Next(); !ok {
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	g.RemoveBot(bot)
+	g.Unspectate(sub)
+	g.Unspectate(updates.Subscription)
+
+	if players := g.Players(); len(players) != 0 {
+		t.Errorf("got %d players after everyone left, want 0", len(players))
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	dir, results := t.TempDir(), t.TempDir()
+	g := New(Settings{Tracks: track.Generator{Config: track.Oval}, Replays: dir, Results: results, Tick: 5 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go g.Run(ctx)
+
+	id, sub := g.Connect()
+	defer g.Disconnect(id, sub)
+
+	// skip the countdown
+	g.do(func() {
+		g.phase = RACE
+		g.recorder = replay.NewRecorder(g.track, g.settings.Ghost, g.settings.Walls, g.settings.Tick)
+	})
+	g.SetPlayerInput(player.Input{Up: true}, id)
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	<-g.Done()
+
+	var events []string
+	for {
+		ev, ok := sub.Next()
+		if !ok || ev.Typ == protocol.SHUTDOWN {
+			break
+		}
+		events = append(events, ev.Typ)
+	}
+
+	if len(events) == 0 || events[len(events)-1] != protocol.BESTLIST {
+		t.Errorf("got events %v, want the standings right before the shutdown", events)
+	}
+
+	if g.Phase() != FINISHED {
+		t.Errorf("race was not aborted")
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Errorf("got %d replays (%v), want the aborted race", len(files), err)
+	}
+
+	files, err = ioutil.ReadDir(results)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("got %d results (%v), want the aborted race", len(files), err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(results, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var standings []Standing
+	if err := json.Unmarshal(data, &standings); err != nil || len(standings) != 1 {
+		t.Errorf("got results %s (%v), want the standing of the player", data, err)
+	}
+}
+
+func TestResultsWithoutReplays(t *testing.T) {
+	results := t.TempDir()
+	g := NewHeadless(track.NewFromSeed(3), Settings{Results: results})
+	g.Join("Senna")
+	g.phase = RACE
+
+	g.shutdown()
+
+	files, err := ioutil.ReadDir(results)
+	if err != nil || len(files) != 1 {
+		t.Errorf("got %d results (%v), want them saved although races are not recorded", len(files), err)
+	}
+}
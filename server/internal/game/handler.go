@@ -3,61 +3,366 @@ package game
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"gitlab.com/resamvi/sennai/internal/player"
 	"gitlab.com/resamvi/sennai/internal/protocol"
+	"gitlab.com/resamvi/sennai/internal/sensor"
+	"gitlab.com/resamvi/sennai/internal/track"
 	"gitlab.com/resamvi/sennai/pkg/pubsub"
 )
 
-// ServeWs should be used and served by a http server to handle websocket requests
-func ServeWs(g *Game, w http.ResponseWriter, r *http.Request) {
+// ServeWs should be used and served by a http server to handle websocket requests.
+// The room to play in is chosen by the `room` query parameter (e.g. /ws?room=team-a).
+// Connections with the `spectate` query parameter (e.g. /ws?spectate=1) only watch without getting a car
+// (and only the events matching the `topics` query parameter if given, e.g. /ws?spectate=1&topics=update,newtrack)
+// and connections with the `delta` query parameter (e.g. /ws?delta=1) are sent deltas instead of updates
+func ServeWs(l *Lobby, w http.ResponseWriter, r *http.Request) {
 	log.Println("Request to /ws")
 
-	// change to websocket connection
+	name := r.URL.Query().Get("room")
+	if name == "" {
+		name = DefaultRoom
+	}
+
+	if !ValidRoom(name) {
+		http.Error(w, ErrRoomName.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var filters []pubsub.Filter
+	if topics := r.URL.Query().Get("topics"); topics != "" {
+		filter, err := pubsub.Topics(strings.Split(topics, ",")...)
+		if err != nil {
+			http.Error(w, "topics: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		filters = append(filters, filter)
+	}
+
+	g, err := l.Join(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer l.Leave(name)
+
+	// change to websocket connection (the upgrader already answered with an HTTP error if it fails)
 	conn, err := protocol.Upgrade(w, r)
 	if err != nil {
-		log.Fatalln("UPGRADE: " + err.Error())
+		log.Println("UPGRADE: " + err.Error())
+		return
 	}
 	defer conn.Close()
 
+	if spectate, _ := strconv.ParseBool(r.URL.Query().Get("spectate")); spectate {
+		sub := g.Spectate(filters...)
+		defer g.Unspectate(sub)
+
+		err := writeInit(g, conn, spectator)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		c := &client{id: spectator, snapshots: snapshots(r)}
+
+		go write(g, c, sub, conn)
+		read(g, c, conn)
+		return
+	}
+
 	// Register on server side
 	playerID, sub := g.Connect()
 	defer g.Disconnect(playerID, sub)
 
+	c := &client{id: playerID, snapshots: snapshots(r)}
+
 	// Start playing. Sending (write) state and receiving (read) inputs
-	go write(g, sub, conn)
-	read(g, conn, playerID)
+	go write(g, c, sub, conn)
+	read(g, c, conn)
+}
+
+// Bounds of the tick of a room so a single room can not hog the server
+// and cars still move in small enough steps to collide
+const (
+	MinTick = 5 * time.Millisecond
+	MaxTick = 100 * time.Millisecond
+)
+
+// spectator is the ID of clients that watch without having a car
+const spectator = -1
+
+// closegrace is the time clients have to answer the close frame when the server shuts down
+const closegrace = 2 * time.Second
+
+// maxstrikes is the amount of messages a client may send that can not be handled before it is disconnected
+const maxstrikes = 5
+
+// client holds the settings of a connection shared by its read and write loop
+type client struct {
+	id        int
+	mu        sync.Mutex
+	sensors   *sensor.Config    // nil until the client asks for sensor readings
+	snapshots *protocol.History // nil if the client wants full updates instead of deltas
+	strikes   int               // messages that could not be handled (only touched by the read loop)
+}
+
+// snapshots returns a history of snapshots if the client asked for deltas
+func snapshots(r *http.Request) *protocol.History {
+	if delta, _ := strconv.ParseBool(r.URL.Query().Get("delta")); delta {
+		return protocol.NewHistory()
+	}
+
+	return nil
+}
+
+// setSensors enables sensor readings for the client's car
+func (c *client) setSensors(cfg sensor.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sensors = &cfg
+}
+
+// sensorConfig returns the requested sensor setup or nil if none was requested
+func (c *client) sensorConfig() *sensor.Config {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.sensors
+}
+
+// ServeRooms lists the open rooms (GET) or creates a new room (POST /rooms?name=team-a&preset=technical&laps=3&ghost=1&walls=1&tick=15ms&broadcast=45ms).
+// The preset determines the kind of tracks generated in the room (see track.Presets),
+// in ghost rooms cars drive through each other and in wall rooms the track sides are solid.
+// The tick is the simulated time of a game cycle and broadcast the time between updates sent to clients
+func ServeRooms(l *Lobby, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(l.List())
+		if err != nil {
+			log.Println("ROOMS: " + err.Error())
+		}
+
+	case http.MethodPost:
+		var err error
+
+		// Rooms race on the tracks of the lobby unless a preset is asked for
+		settings := l.defaults()
+
+		if preset := r.URL.Query().Get("preset"); preset != "" {
+			cfg, ok := track.Presets[preset]
+			if !ok {
+				http.Error(w, "unknown preset: "+preset, http.StatusBadRequest)
+				return
+			}
+
+			settings.Tracks = track.Generator{Config: cfg}
+		}
+
+		if laps := r.URL.Query().Get("laps"); laps != "" {
+			settings.Laps, err = strconv.Atoi(laps)
+			if err != nil || settings.Laps < 1 {
+				http.Error(w, "laps must be a positive integer", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if ghost := r.URL.Query().Get("ghost"); ghost != "" {
+			settings.Ghost, err = strconv.ParseBool(ghost)
+			if err != nil {
+				http.Error(w, "ghost must be a boolean", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if walls := r.URL.Query().Get("walls"); walls != "" {
+			settings.Walls, err = strconv.ParseBool(walls)
+			if err != nil {
+				http.Error(w, "walls must be a boolean", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if tick := r.URL.Query().Get("tick"); tick != "" {
+			settings.Tick, err = time.ParseDuration(tick)
+			if err != nil || settings.Tick < MinTick || settings.Tick > MaxTick {
+				http.Error(w, fmt.Sprintf("tick must be a duration between %v and %v", MinTick, MaxTick), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if broadcast := r.URL.Query().Get("broadcast"); broadcast != "" {
+			settings.Broadcast, err = time.ParseDuration(broadcast)
+			if err != nil || settings.Broadcast < MinTick {
+				http.Error(w, fmt.Sprintf("broadcast must be a duration of at least %v", MinTick), http.StatusBadRequest)
+				return
+			}
+		}
+
+		_, err = l.Create(r.URL.Query().Get("name"), settings)
+		switch err {
+		case nil:
+			w.WriteHeader(http.StatusCreated)
+		case ErrRoomExists:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
 }
 
 // write will push changes of the game state (being notified thanks to the
 // supplied subscription) to the websocket connection to be sent to the client
-func write(g *Game, sub *pubsub.Subscription, conn *protocol.Conn) {
+func write(g *Game, c *client, sub *pubsub.Subscription, conn *protocol.Conn) {
 	for {
-		event := <-sub.Ch
+		event, ok := sub.Next()
+		if !ok {
+			switch err := sub.Err(); err {
+			case nil:
+			case pubsub.ErrClosed:
+				// The game ended without the client receiving SHUTDOWN (e.g. it filtered the topic)
+				err = conn.Shutdown(protocol.SHUTDOWN, closegrace)
+				if err != nil {
+					log.Println(err)
+				}
+			default:
+				// Slow clients are cut off so their read loop ends as well
+				log.Printf("WRITE: client %d: %v\n", c.id, err)
+				conn.Close()
+			}
+			return
+		}
 
-		msg := new(bytes.Buffer)
-		err := json.NewEncoder(msg).Encode(event.Payload)
+		typ, payload := event.Typ, event.Payload
+		if typ == protocol.UPDATE && c.snapshots != nil {
+			players := payload.([]player.Player)
+			typ, payload = protocol.DELTA, c.snapshots.Next(tick(players), cars(players))
+		}
+
+		msg, err := encode(conn, typ, payload)
 		if err != nil {
-			log.Fatalln("WRITE: " + err.Error())
+			log.Println("WRITE: " + err.Error())
+			continue
 		}
 
-		err = conn.WriteMessage(event.Typ, msg.Bytes())
+		err = conn.WriteMessage(typ, msg)
 		if err != nil {
 			log.Println(err)
 			break
 		}
 
+		// The read loop ends when the client answers the close frame (or does not within the grace period)
+		if typ == protocol.SHUTDOWN {
+			err = conn.Shutdown(protocol.SHUTDOWN, closegrace)
+			if err != nil {
+				log.Println(err)
+			}
+			return
+		}
+
 		if event.Typ != protocol.UPDATE {
-			log.Printf("SENT: %s - %s\n", event.Typ, msg.String())
+			log.Printf("SENT: %s - %s\n", event.Typ, msg)
+			continue
+		}
+
+		err = writeSensors(g, c, event.Payload.([]player.Player), conn)
+		if err != nil {
+			log.Println(err)
+			break
+		}
+	}
+}
+
+// encode serializes the payload of a message in the format the connection negotiated.
+// Updates and deltas of binary connections are packed tightly while everything else is JSON
+func encode(conn *protocol.Conn, typ string, payload interface{}) ([]byte, error) {
+	if conn.Binary() {
+		switch typ {
+		case protocol.UPDATE:
+			players := payload.([]player.Player)
+			return protocol.EncodeUpdate(tick(players), cars(players)), nil
+		case protocol.DELTA:
+			return protocol.EncodeDelta(payload.(protocol.Delta)), nil
+		}
+	}
+
+	msg := new(bytes.Buffer)
+	err := json.NewEncoder(msg).Encode(payload)
+	return msg.Bytes(), err
+}
+
+// cars converts players to the state of their cars sent over the wire
+func cars(players []player.Player) []protocol.Car {
+	result := make([]protocol.Car, len(players))
+	for i, p := range players {
+		result[i] = protocol.Car{
+			ID:       p.ID,
+			Name:     p.Name,
+			X:        p.X,
+			Y:        p.Y,
+			Rotation: p.Rotation,
+			Progress: p.Progress,
+			LastSeq:  p.LastSeq,
+			VX:       p.Velocity.X,
+			VY:       p.Velocity.Y,
+		}
+	}
+
+	return result
+}
+
+// tick returns the latest game cycle the players' states were calculated in
+func tick(players []player.Player) uint32 {
+	latest := 0
+	for _, p := range players {
+		if p.Tick > latest {
+			latest = p.Tick
+		}
+	}
+
+	return uint32(latest)
+}
+
+// writeSensors sends the sensor readings of the client's car if the client asked for them
+func writeSensors(g *Game, c *client, players []player.Player, conn *protocol.Conn) error {
+	cfg := c.sensorConfig()
+	if cfg == nil {
+		return nil
+	}
+
+	for _, p := range players {
+		if p.ID != c.id {
+			continue
 		}
+
+		msg, err := json.Marshal(sensor.Read(p, g.Layout(), *cfg))
+		if err != nil {
+			return err
+		}
+
+		return conn.WriteMessage(protocol.SENSORS, msg)
 	}
+
+	return nil
 }
 
 // read will pull messages from the websocket connection sent from the client
-// to parse and act upon them
-func read(g *Game, conn *protocol.Conn, playerID int) {
+// to parse and act upon them. Messages that can not be handled are answered with an ERROR
+func read(g *Game, c *client, conn *protocol.Conn) {
+	playerID := c.id
+
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
@@ -65,72 +370,144 @@ func read(g *Game, conn *protocol.Conn, playerID int) {
 			break
 		}
 
-		prefix, payload := protocol.Parse(message)
+		msg, err := protocol.Decode(message)
+		if err != nil {
+			log.Printf("RECEIVED (%v): %s\n", err, message)
 
-		switch prefix {
-		case protocol.INPUT:
-			var input player.Input
+			if !reject(c, conn, err) {
+				return
+			}
+			continue
+		}
 
-			err := json.Unmarshal(payload, &input)
-			if err != nil {
-				log.Fatalln("INPUT: " + err.Error())
+		// Acknowledgements are sent by everyone receiving deltas
+		if ack, ok := msg.(protocol.Ack); ok {
+			if c.snapshots == nil {
+				log.Printf("ACK: unexpected acknowledgement %d\n", ack.Seq)
+
+				if !reject(c, conn, &protocol.Error{Code: protocol.CodeInvalid, Message: "ack: not receiving deltas"}) {
+					return
+				}
+				continue
 			}
 
-			g.SetPlayerInput(input, playerID)
-		case protocol.HELLO:
-			var name string
+			c.snapshots.Ack(ack.Seq)
+			continue
+		}
 
-			err := json.Unmarshal(payload, &name)
-			if err != nil {
-				log.Fatalln("HELLO: " + err.Error())
+		// Spectators have no car to control but may ask for the setup again (e.g. after a race)
+		if c.id == spectator {
+			if _, ok := msg.(protocol.Hello); ok {
+				err = writeInit(g, conn, spectator)
+				if err != nil {
+					log.Println(err)
+					return
+				}
 			}
 
-			g.SetPlayerName(name, playerID)
+			log.Printf("RECEIVED (spectator): %s\n", message)
+			continue
+		}
 
-			// Send init/setup data to client
-			// TODO: Use anonymous structs
-			msg := toJSON("cars", g.Players())
-			msg = appendKey("track", g.Track(), msg)
-			msg = appendKey("id", playerID, msg)
+		switch m := msg.(type) {
+		case protocol.Input:
+			err = g.SetPlayerInput(m.Input, playerID)
+			if err != nil && !reject(c, conn, err) {
+				return
+			}
+		case protocol.Hello:
+			if m.Car != "" {
+				err = g.SetPlayerCar(m.Car, playerID)
+				if err != nil && !reject(c, conn, err) {
+					return
+				}
+			}
 
-			err = conn.WriteMessage(protocol.INIT, msg)
+			err = g.SetPlayerName(m.Name, playerID)
+			if err != nil && !reject(c, conn, err) {
+				return
+			}
+
+			err = writeInit(g, conn, playerID)
 			if err != nil {
 				log.Println(err)
 				return
 			}
+		case protocol.Sense:
+			c.setSensors(m.Config)
 		}
 
 		log.Printf("RECEIVED: %s\n", message)
 	}
 }
 
-// toJSON creates a JSON object with the provided field as key and item as value
-func toJSON(field string, item interface{}) []byte {
-	m := make(map[string]interface{})
-	m[field] = item
+// reject answers a message that could not be handled with an ERROR and counts it against the client.
+// It reports whether the client may stay connected, i.e. it did not exceed maxstrikes
+// and the error could be sent
+func reject(c *client, conn *protocol.Conn, err error) bool {
+	c.strikes++
+	if c.strikes > maxstrikes {
+		err = &protocol.Error{Code: protocol.CodeLimit, Message: fmt.Sprintf("more than %d invalid messages", maxstrikes)}
+	}
 
-	j, err := json.Marshal(m)
-	if err != nil {
-		log.Fatal("toJSON: " + err.Error())
+	werr := writeError(conn, err)
+	if werr != nil {
+		log.Println(werr)
+		return false
 	}
 
-	return j
+	if c.strikes > maxstrikes {
+		log.Printf("disconnecting client %d after %d invalid messages\n", c.id, c.strikes)
+		return false
+	}
+
+	return true
 }
 
-// appendKey adds a key to the provided json object `data` with `item as value
-func appendKey(field string, item interface{}, data []byte) []byte {
-	var m map[string]interface{}
+// writeError tells the client why its message could not be handled
+func writeError(conn *protocol.Conn, err error) error {
+	e, ok := err.(*protocol.Error)
+	if !ok {
+		e = &protocol.Error{Code: protocol.CodeInvalid, Message: err.Error()}
+	}
 
-	err := json.Unmarshal(data, &m)
+	msg, err := json.Marshal(e)
 	if err != nil {
-		log.Fatal("appendKey (unmarshal): " + err.Error())
+		return err
 	}
-	m[field] = item
 
-	j, err := json.Marshal(m)
+	return conn.WriteMessage(protocol.ERROR, msg)
+}
+
+// setup is the data a client needs to set up the game (sent as INIT)
+type setup struct {
+	Cars    []player.Player        `json:"cars"`
+	Track   track.Track            `json:"track"`
+	ID      int                    `json:"id"`      // the client's own car (or -1 for spectators)
+	Specs   map[int]player.CarSpec `json:"specs"`   // car spec of every player by ID
+	Dt      float64                `json:"dt"`      // simulated milliseconds of a game cycle (fractional for ticks like 7.5ms)
+	Version int                    `json:"version"` // version of the protocol the server speaks
+}
+
+// millis returns the duration in milliseconds without truncating fractions
+// so clients predict with the exact tick of the server
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// writeInit sends the setup of the game. The id is the client's own car (or -1 for spectators)
+func writeInit(g *Game, conn *protocol.Conn, id int) error {
+	msg, err := json.Marshal(setup{
+		Cars:    g.Players(),
+		Track:   g.Track(),
+		ID:      id,
+		Specs:   g.Specs(),
+		Dt:      millis(g.settings.Tick),
+		Version: protocol.Version,
+	})
 	if err != nil {
-		log.Fatal("appendKey: " + err.Error())
+		return err
 	}
 
-	return j
+	return conn.WriteMessage(protocol.INIT, msg)
 }
@@ -0,0 +1,201 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gitlab.com/resamvi/sennai/internal/protocol"
+	"gitlab.com/resamvi/sennai/internal/track"
+)
+
+func TestStrikes(t *testing.T) {
+	l := NewLobby(func() Settings {
+		return Settings{Tracks: track.Generator{Config: track.Oval}}
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWs(l, w, r)
+	}))
+	defer server.Close()
+
+	// the upgrader only accepts pages of the hosts the game is served on
+	header := http.Header{"Origin": []string{"http://localhost:7999"}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	invalid := []string{`input`, `input|{"up":`, `honk|{}`, `hello|{"version":99}`, `hello|{"name":"Senna","car":"tank"}`, `sense|{"rays":0}`}
+	for _, msg := range invalid {
+		err = conn.WriteMessage(websocket.TextMessage, []byte(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var codes []string
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+
+		prefix, payload, err := protocol.Parse(message)
+		if err != nil || prefix != protocol.ERROR {
+			continue
+		}
+
+		var e protocol.Error
+		err = json.Unmarshal(payload, &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		codes = append(codes, e.Code)
+	}
+
+	want := []string{protocol.CodeMalformed, protocol.CodeInvalid, protocol.CodeUnknown, protocol.CodeVersion, protocol.CodeInvalid, protocol.CodeLimit}
+	if strings.Join(codes, ",") != strings.Join(want, ",") {
+		t.Errorf("got errors %v, want %v before being disconnected", codes, want)
+	}
+}
+
+func TestShutdownClose(t *testing.T) {
+	l := NewLobby(func() Settings {
+		return Settings{Tracks: track.Generator{Config: track.Oval}}
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWs(l, w, r)
+	}))
+	defer server.Close()
+
+	// a player receives every event while the spectator filtered out SHUTDOWN
+	header := http.Header{"Origin": []string{"http://localhost:7999"}}
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	player, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.Close()
+
+	spectator, _, err := websocket.DefaultDialer.Dial(url+"?spectate=1&topics=update", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spectator.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- l.Shutdown(ctx)
+	}()
+
+	tests := []struct {
+		name     string
+		conn     *websocket.Conn
+		announce bool
+	}{
+		{"player", player, true},
+		{"filtered spectator", spectator, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			announced := false
+			tt.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for {
+				_, message, err := tt.conn.ReadMessage()
+				if err != nil {
+					if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+						t.Errorf("got %v, want close frame going away", err)
+					}
+					break
+				}
+
+				if prefix, _, _ := protocol.Parse(message); prefix == protocol.SHUTDOWN {
+					announced = true
+				}
+			}
+
+			if announced != tt.announce {
+				t.Errorf("got shutdown announced %v, want %v", announced, tt.announce)
+			}
+		})
+	}
+
+	if err := <-shutdown; err != nil {
+		t.Errorf("connections were not drained: %v", err)
+	}
+
+	if _, err := l.Join(DefaultRoom); err != ErrShuttingDown {
+		t.Errorf("got %v, want %v", err, ErrShuttingDown)
+	}
+}
+
+func TestCreateRoomTracks(t *testing.T) {
+	custom := track.NewFromSeed(7)
+	custom.Name = "custom"
+
+	l := NewLobby(func() Settings {
+		return Settings{Tracks: track.NewRotation([]track.Track{custom})}
+	})
+
+	tests := []struct {
+		name   string
+		room   string
+		preset string
+		custom bool
+	}{
+		{"lobby tracks", "rotation", "", true},
+		{"preset", "oval", "oval", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ServeRooms(l, w, httptest.NewRequest(http.MethodPost, "/rooms?name="+tt.room+"&preset="+tt.preset, nil))
+			if w.Code != http.StatusCreated {
+				t.Fatalf("got status %d: %s", w.Code, w.Body)
+			}
+
+			g, ok := l.Get(tt.room)
+			if !ok {
+				t.Fatalf("room was not created")
+			}
+
+			if got := g.Track().Name == custom.Name; got != tt.custom {
+				t.Errorf("got track %q, want the lobby's track %v", g.Track().Name, tt.custom)
+			}
+		})
+	}
+}
+
+func TestMillis(t *testing.T) {
+	tests := []struct {
+		tick time.Duration
+		want float64
+	}{
+		{30 * time.Millisecond, 30},
+		{7500 * time.Microsecond, 7.5},
+		{MinTick, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tick.String(), func(t *testing.T) {
+			if got := millis(tt.tick); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
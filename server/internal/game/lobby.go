@@ -0,0 +1,243 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/resamvi/sennai/pkg/pubsub"
+)
+
+// DefaultRoom is joined by clients that did not ask for a specific room
+const DefaultRoom = "default"
+
+var (
+	// ErrRoomExists is returned when creating a room whose name is already taken
+	ErrRoomExists = errors.New("room already exists")
+
+	// ErrRoomName is returned when a room name is empty, too long or contains unsupported characters
+	ErrRoomName = errors.New("invalid room name")
+
+	// ErrShuttingDown is returned when joining or creating a room while the lobby shuts down
+	ErrShuttingDown = errors.New("server is shutting down")
+)
+
+// idlegrace is how long a created room stays open without anybody joining it
+const idlegrace = time.Minute
+
+// room names end up in URLs and logs so keep them simple
+var roomName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// room is a named game together with the amount of connections currently using it
+type room struct {
+	game  *Game
+	conns int
+}
+
+// RoomInfo is the publicly viewable summary of a room
+type RoomInfo struct {
+	Name    string       `json:"name"`
+	Players int          `json:"players"`
+	Events  pubsub.Stats `json:"events"`
+}
+
+// Lobby is a registry of rooms where each room runs its own game
+// (i.e. its own game loop, track, phases and events).
+// Rooms are torn down as soon as the last connection leaves
+// (or when nobody joined a created room within a grace period)
+type Lobby struct {
+	mu       sync.Mutex
+	rooms    map[string]*room
+	defaults func() Settings // settings of rooms that are created by joining
+	idle     time.Duration   // time created rooms are kept open without connections
+	ctx      context.Context // games of the rooms run until it is done (see Shutdown)
+	cancel   context.CancelFunc
+	drained  chan struct{} // closed when the lobby shuts down and the last room was torn down
+}
+
+// NewLobby creates an empty lobby. Rooms that are created by joining
+// use the settings returned by calling `defaults`
+func NewLobby(defaults func() Settings) *Lobby {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Lobby{rooms: make(map[string]*room), defaults: defaults, idle: idlegrace, ctx: ctx, cancel: cancel, drained: make(chan struct{})}
+}
+
+// Shutdown stops every game (which tells its clients to disconnect) and waits
+// until every connection left or the context is done. No rooms can be opened afterwards
+func (l *Lobby) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	l.cancel()
+
+	// Nobody is going to leave rooms without connections
+	for name, r := range l.rooms {
+		if r.conns == 0 {
+			delete(l.rooms, name)
+		}
+	}
+	l.drain()
+	l.mu.Unlock()
+
+	select {
+	case <-l.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drain signals Shutdown once the last room is gone. Caller has to hold the lock
+func (l *Lobby) drain() {
+	if l.ctx.Err() == nil || len(l.rooms) > 0 {
+		return
+	}
+
+	select {
+	case <-l.drained:
+	default:
+		close(l.drained)
+	}
+}
+
+// ValidRoom reports whether the name can be used for a room
+func ValidRoom(name string) bool {
+	return roomName.MatchString(name)
+}
+
+// Create opens a new room with the given name and starts its game configured by the settings.
+// The room is torn down if nobody joined it within a grace period
+func (l *Lobby) Create(name string, settings Settings) (*Game, error) {
+	if !ValidRoom(name) {
+		return nil, ErrRoomName
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.ctx.Err() != nil {
+		return nil, ErrShuttingDown
+	}
+
+	if _, ok := l.rooms[name]; ok {
+		return nil, ErrRoomExists
+	}
+
+	r := l.open(name, settings)
+	time.AfterFunc(l.idle, func() {
+		l.reap(name, r)
+	})
+
+	return r.game, nil
+}
+
+// reap tears down the room if it is still open and nobody is connected to it
+func (l *Lobby) reap(name string, r *room) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rooms[name] != r || r.conns > 0 {
+		return
+	}
+
+	l.close(name, r)
+}
+
+// Join returns the game of the room with the given name and counts
+// the caller as one of its connections. The room is created if it does not exist yet.
+// Every call to Join has to be followed up by a call to Leave
+func (l *Lobby) Join(name string) (*Game, error) {
+	if !ValidRoom(name) {
+		return nil, ErrRoomName
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.ctx.Err() != nil {
+		return nil, ErrShuttingDown
+	}
+
+	r, ok := l.rooms[name]
+	if !ok {
+		r = l.open(name, l.defaults())
+	}
+	r.conns++
+
+	return r.game, nil
+}
+
+// Leave releases a connection of the room and tears the room down when it is empty
+func (l *Lobby) Leave(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r, ok := l.rooms[name]
+	if !ok {
+		return
+	}
+
+	r.conns--
+	if r.conns > 0 {
+		return
+	}
+
+	l.close(name, r)
+}
+
+// Get returns the game of a room if it exists
+func (l *Lobby) Get(name string) (*Game, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r, ok := l.rooms[name]
+	if !ok {
+		return nil, false
+	}
+
+	return r.game, true
+}
+
+// List returns a summary of every open room sorted by name
+func (l *Lobby) List() []RoomInfo {
+	// the games are asked without the lock as they answer only between two cycles
+	l.mu.Lock()
+	games := make(map[string]*Game, len(l.rooms))
+	for name, r := range l.rooms {
+		games[name] = r.game
+	}
+	l.mu.Unlock()
+
+	list := make([]RoomInfo, 0, len(games))
+	for name, g := range games {
+		list = append(list, RoomInfo{Name: name, Players: len(g.Players()), Events: g.Events()})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// open creates and starts a room. Caller has to hold the lock
+func (l *Lobby) open(name string, settings Settings) *room {
+	r := &room{game: New(settings)}
+	l.rooms[name] = r
+
+	go r.game.Run(l.ctx)
+
+	log.Println("Opened room:", name)
+	return r
+}
+
+// close stops the game of a room and removes it. Caller has to hold the lock
+func (l *Lobby) close(name string, r *room) {
+	r.game.Stop()
+	delete(l.rooms, name)
+	l.drain()
+
+	log.Println("Closed room:", name)
+}
@@ -0,0 +1,143 @@
+package game
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gitlab.com/resamvi/sennai/internal/track"
+)
+
+func TestLobby(t *testing.T) {
+	l := NewLobby(func() Settings {
+		return Settings{Tracks: track.Generator{Config: track.Default}}
+	})
+
+	a, err := l.Join("team-a")
+	if err != nil {
+		t.Fatalf("join: %v", err)
+	}
+
+	b, err := l.Join("team-a")
+	if err != nil {
+		t.Fatalf("join: %v", err)
+	}
+
+	if a != b {
+		t.Errorf("joining the same room twice returned different games")
+	}
+
+	if _, err := l.Create("team-a", Settings{Tracks: track.Generator{Config: track.Default}}); err != ErrRoomExists {
+		t.Errorf("got %v, want %v", err, ErrRoomExists)
+	}
+
+	if _, err := l.Create("team-b", Settings{Tracks: track.Generator{Config: track.Oval}}); err != nil {
+		t.Errorf("create: %v", err)
+	}
+
+	got := l.List()
+	if len(got) != 2 || got[0].Name != "team-a" || got[1].Name != "team-b" {
+		t.Errorf("got %v, want [team-a team-b]", got)
+	}
+
+	l.Leave("team-a")
+	if _, ok := l.Get("team-a"); !ok {
+		t.Errorf("room was torn down while a connection is left")
+	}
+
+	l.Leave("team-a")
+	if _, ok := l.Get("team-a"); ok {
+		t.Errorf("empty room was not torn down")
+	}
+}
+
+func TestListUnlocked(t *testing.T) {
+	l := NewLobby(func() Settings {
+		return Settings{Tracks: track.Generator{Config: track.Oval}}
+	})
+
+	// a game that is not running yet answers only once it runs
+	busy := New(Settings{Tracks: track.Generator{Config: track.Oval}})
+	l.mu.Lock()
+	l.rooms["busy"] = &room{game: busy}
+	l.mu.Unlock()
+
+	listed := make(chan []RoomInfo)
+	go func() { listed <- l.List() }()
+	time.Sleep(50 * time.Millisecond) // until the listing waits for the busy room
+
+	joined := make(chan error)
+	go func() {
+		_, err := l.Join("other")
+		joined <- err
+	}()
+
+	select {
+	case err := <-joined:
+		if err != nil {
+			t.Fatalf("join: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("joining waited for the listing of a busy room")
+	}
+
+	go busy.Run(context.Background())
+	defer busy.Stop()
+
+	if got := <-listed; len(got) == 0 || got[0].Name != "busy" {
+		t.Errorf("got %v, want the busy room", got)
+	}
+}
+
+func TestReapCreated(t *testing.T) {
+	l := NewLobby(func() Settings {
+		return Settings{Tracks: track.Generator{Config: track.Oval}}
+	})
+	l.idle = 10 * time.Millisecond
+
+	empty, err := l.Create("empty", Settings{Tracks: track.Generator{Config: track.Oval}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if _, err := l.Create("joined", Settings{Tracks: track.Generator{Config: track.Oval}}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	l.Join("joined")
+
+	select {
+	case <-empty.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("room nobody joined is still running")
+	}
+
+	if _, ok := l.Get("empty"); ok {
+		t.Errorf("room nobody joined was not torn down")
+	}
+
+	if _, ok := l.Get("joined"); !ok {
+		t.Errorf("joined room was torn down")
+	}
+}
+
+func TestValidRoom(t *testing.T) {
+	var tests = []struct {
+		name string
+		room string
+		want bool
+	}{
+		{"Simple name", "team-a", true},
+		{"Empty name", "", false},
+		{"Path characters", "../etc", false},
+		{"Too long", "abcdefghijklmnopqrstuvwxyz0123456789", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidRoom(tt.room)
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"gitlab.com/resamvi/sennai/internal/player"
+	"gitlab.com/resamvi/sennai/internal/protocol"
+	"gitlab.com/resamvi/sennai/internal/replay"
+	"gitlab.com/resamvi/sennai/pkg/math"
+)
+
+// Verify re-simulates the race of a replay from its recorded inputs
+// and returns an error at the first frame whose states differ from the recorded ones
+func Verify(r *replay.Replay) error {
+	players := make(map[int]*player.Player)
+
+	for i, frame := range r.Frames {
+		present := make(map[int]bool)
+
+		// Players that joined during the race are placed where they were recorded
+		for _, s := range frame.States {
+			present[s.ID] = true
+
+			p, ok := players[s.ID]
+			if !ok {
+				spawned := player.New(s.ID, math.Point{X: s.X, Y: s.Y}, s.Rotation)
+				p = &spawned
+				players[s.ID] = p
+			}
+
+			if p.X != s.X || p.Y != s.Y || p.Rotation != s.Rotation {
+				return fmt.Errorf("frame %d: player %d diverged: got (%.2f, %.2f) %.2f°, recorded (%.2f, %.2f) %.2f°",
+					i, s.ID, p.X, p.Y, p.Rotation, s.X, s.Y, s.Rotation)
+			}
+		}
+
+		for id := range players {
+			if !present[id] {
+				delete(players, id)
+			}
+		}
+
+		for _, cmd := range frame.Inputs {
+			p, ok := players[cmd.ID]
+			if !ok {
+				return fmt.Errorf("frame %d: unknown player %d", i, cmd.ID)
+			}
+			p.Input = cmd.Input
+		}
+
+		for _, car := range frame.Cars {
+			p, ok := players[car.ID]
+			if !ok {
+				return fmt.Errorf("frame %d: unknown player %d", i, car.ID)
+			}
+			p.Car = car.Spec
+		}
+
+		sorted := make([]*player.Player, 0, len(frame.States))
+		for _, s := range frame.States {
+			sorted = append(sorted, players[s.ID])
+		}
+
+		simulate(sorted, r.Track, r.Ghost, r.Walls, r.Tick)
+	}
+
+	return nil
+}
+
+// ServePlayback streams the recorded frames of a replay to a spectating client
+// in the same way a live race is sent (i.e. as init followed by updates)
+func ServePlayback(r *replay.Replay, w http.ResponseWriter, req *http.Request) {
+	if len(r.Frames) == 0 {
+		http.Error(w, "replay has no frames", http.StatusUnprocessableEntity)
+		return
+	}
+
+	conn, err := protocol.Upgrade(w, req)
+	if err != nil {
+		log.Println("UPGRADE: " + err.Error())
+		return
+	}
+	defer conn.Close()
+
+	// Keep reading to notice when the client leaves
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Viewers watch like spectators of a live race instead of driving one of the cars
+	msg, err := json.Marshal(setup{
+		Cars:    playback(r, r.Frames[0]),
+		Track:   r.Track,
+		ID:      spectator,
+		Specs:   specs(r),
+		Dt:      millis(r.Tick),
+		Version: protocol.Version,
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	err = conn.WriteMessage(protocol.INIT, msg)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	clock := time.NewTicker(r.Tick)
+	defer clock.Stop()
+
+	for _, frame := range r.Frames {
+		select {
+		case <-gone:
+			return
+		case <-clock.C:
+		}
+
+		msg, err := encode(conn, protocol.UPDATE, playback(r, frame))
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		err = conn.WriteMessage(protocol.UPDATE, msg)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+	}
+}
+
+// specs returns the car spec every player of the replay drove last
+func specs(r *replay.Replay) map[int]player.CarSpec {
+	result := make(map[int]player.CarSpec)
+	for _, frame := range r.Frames {
+		for _, car := range frame.Cars {
+			result[car.ID] = car.Spec
+		}
+	}
+
+	return result
+}
+
+// playback converts the recorded states of a frame back into players
+func playback(r *replay.Replay, frame replay.Frame) []player.Player {
+	result := make([]player.Player, 0, len(frame.States))
+	for _, s := range frame.States {
+		result = append(result, player.Player{
+			Name:     r.Names[s.ID],
+			ID:       s.ID,
+			X:        s.X,
+			Y:        s.Y,
+			Rotation: s.Rotation,
+		})
+	}
+
+	return result
+}
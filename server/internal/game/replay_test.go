@@ -0,0 +1,122 @@
+package game
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"gitlab.com/resamvi/sennai/internal/protocol"
+	"gitlab.com/resamvi/sennai/internal/replay"
+	"gitlab.com/resamvi/sennai/internal/track"
+)
+
+func TestVerify(t *testing.T) {
+	g := NewHeadless(track.NewFromSeed(3), Settings{})
+	g.AddBot("Careful", Follower{Lookahead: 8})
+	eager := g.AddBot("Eager", Follower{Lookahead: 2})
+	if err := g.SetPlayerCar("drift", eager); err != nil {
+		t.Fatal(err)
+	}
+
+	g.recorder = replay.NewRecorder(g.track, g.settings.Ghost, g.settings.Walls, g.settings.Tick)
+
+	for i := 0; i < 300; i++ {
+		g.Update()
+	}
+
+	rp := g.recorder.Replay()
+	if err := Verify(rp); err != nil {
+		t.Fatalf("recorded race is not reproducible: %v", err)
+	}
+
+	rp.Frames[100].States[1].X += 1
+	if err := Verify(rp); err == nil {
+		t.Errorf("tampered replay was verified")
+	}
+
+	rp.Frames[100].States[1].X -= 1
+	inputs := rp.Frames[50].Inputs
+	rp.Frames[50].Inputs = append(inputs[:len(inputs):len(inputs)], replay.Command{ID: 99})
+	if err := Verify(rp); err == nil || !strings.Contains(err.Error(), "unknown player 99") {
+		t.Errorf("got %v, want input of an unknown player to be rejected", err)
+	}
+
+	rp.Frames[50].Inputs = inputs
+	rp.Frames[60].Cars = append(rp.Frames[60].Cars, replay.Car{ID: 99})
+	if err := Verify(rp); err == nil || !strings.Contains(err.Error(), "unknown player 99") {
+		t.Errorf("got %v, want car of an unknown player to be rejected", err)
+	}
+}
+
+func TestServePlayback(t *testing.T) {
+	g := NewHeadless(track.NewFromSeed(3), Settings{})
+	g.AddBot("Careful", Follower{Lookahead: 8})
+	g.recorder = replay.NewRecorder(g.track, g.settings.Ghost, g.settings.Walls, g.settings.Tick)
+	g.Update()
+
+	tests := []struct {
+		name   string
+		replay *replay.Replay
+		status int
+	}{
+		{"recorded", g.recorder.Replay(), http.StatusSwitchingProtocols},
+		{"no frames", &replay.Replay{Track: g.track}, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ServePlayback(tt.replay, w, r)
+			}))
+			defer server.Close()
+
+			header := http.Header{"Origin": []string{"http://localhost:7999"}}
+			conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+			if resp == nil || resp.StatusCode != tt.status {
+				t.Fatalf("got response %v (%v), want status %d", resp, err, tt.status)
+			}
+
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var init setup
+			if _, payload, _ := protocol.Parse(message); json.Unmarshal(payload, &init) != nil || init.ID != spectator || init.Dt != 30 {
+				t.Errorf("got init %s, want the id of a spectator and a dt of 30ms", message)
+			}
+		})
+	}
+}
+
+func TestReplayLimit(t *testing.T) {
+	dir := t.TempDir()
+	g := NewHeadless(track.NewFromSeed(3), Settings{Replays: dir})
+	g.AddBot("Careful", Follower{Lookahead: 8})
+
+	g.Update()
+	g.recorder = replay.NewRecorder(g.track, g.settings.Ghost, g.settings.Walls, replay.MaxDuration/2)
+
+	for i := 0; i < 3; i++ {
+		g.Update()
+	}
+	g.saving.Wait()
+
+	if g.recorder != nil {
+		t.Errorf("still recording past the maximum duration")
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Errorf("got %d replays saved (%v), want 1", len(files), err)
+	}
+}
@@ -0,0 +1,144 @@
+package player
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// CarSpec describes how a car handles
+type CarSpec struct {
+	Class            string  `json:"class"`
+	TurnSpeed        float64 `json:"turnSpeed"`        // amount that front wheel turns
+	Wheelbase        float64 `json:"wheelbase"`        // distance from front to rear wheel
+	EnginePower      float64 `json:"enginePower"`      // power to accelerate
+	BrakePower       float64 `json:"brakePower"`       // power to brake
+	OnTrackFriction  float64 `json:"onTrackFriction"`  // friction force applied by the asphalt ground
+	OffTrackFriction float64 `json:"offTrackFriction"` // friction force applied by sand ground
+	Drag             float64 `json:"drag"`             // wind resistance
+	Traction         float64 `json:"traction"`         // drift factor (1 = basically on rails)
+	Mass             float64 `json:"mass"`             // weight when colliding with other cars
+}
+
+// Car classes to choose from
+var (
+	Standard = CarSpec{
+		Class:            "standard",
+		TurnSpeed:        4.0,
+		Wheelbase:        40.0,
+		EnginePower:      7.0,
+		BrakePower:       -2.0,
+		OnTrackFriction:  -0.06,
+		OffTrackFriction: -0.3,
+		Drag:             -0.0015,
+		Traction:         0.00001,
+		Mass:             1.0,
+	}
+
+	// Grip sticks to the road but has less power
+	Grip = CarSpec{
+		Class:            "grip",
+		TurnSpeed:        4.5,
+		Wheelbase:        40.0,
+		EnginePower:      6.0,
+		BrakePower:       -2.5,
+		OnTrackFriction:  -0.06,
+		OffTrackFriction: -0.3,
+		Drag:             -0.0015,
+		Traction:         0.3,
+		Mass:             1.0,
+	}
+
+	// Drift slides through corners and is quick on straights
+	Drift = CarSpec{
+		Class:            "drift",
+		TurnSpeed:        5.0,
+		Wheelbase:        36.0,
+		EnginePower:      7.5,
+		BrakePower:       -1.5,
+		OnTrackFriction:  -0.055,
+		OffTrackFriction: -0.3,
+		Drag:             -0.0015,
+		Traction:         0.000001,
+		Mass:             0.9,
+	}
+
+	// Heavy is slow to turn but pushes other cars aside
+	Heavy = CarSpec{
+		Class:            "heavy",
+		TurnSpeed:        3.0,
+		Wheelbase:        48.0,
+		EnginePower:      7.0,
+		BrakePower:       -2.5,
+		OnTrackFriction:  -0.06,
+		OffTrackFriction: -0.25,
+		Drag:             -0.0015,
+		Traction:         0.01,
+		Mass:             2.0,
+	}
+)
+
+var (
+	classesMu sync.RWMutex
+	classes   = map[string]CarSpec{
+		Standard.Class: Standard,
+		Grip.Class:     Grip,
+		Drift.Class:    Drift,
+		Heavy.Class:    Heavy,
+	}
+)
+
+// Validate checks that the spec describes a drivable car
+func (c CarSpec) Validate() error {
+	if c.Class == "" {
+		return fmt.Errorf("class must not be empty")
+	}
+	if c.Wheelbase <= 0 {
+		return fmt.Errorf("wheelbase must be positive, got %f", c.Wheelbase)
+	}
+	if c.Mass <= 0 {
+		return fmt.Errorf("mass must be positive, got %f", c.Mass)
+	}
+	if c.Traction < 0 || c.Traction > 1 {
+		return fmt.Errorf("traction must be between 0 and 1, got %f", c.Traction)
+	}
+
+	return nil
+}
+
+// Class returns the current spec of a car class
+func Class(name string) (CarSpec, bool) {
+	classesMu.RLock()
+	defer classesMu.RUnlock()
+
+	spec, ok := classes[name]
+	return spec, ok
+}
+
+// Classes returns the names of all car classes sorted alphabetically
+func Classes() []string {
+	classesMu.RLock()
+	defer classesMu.RUnlock()
+
+	names := make([]string, 0, len(classes))
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// SetClass changes (or adds) a car class. Cars that already chose the class keep their old spec
+func SetClass(spec CarSpec) error {
+	err := spec.Validate()
+	if err != nil {
+		return err
+	}
+
+	classesMu.Lock()
+	defer classesMu.Unlock()
+
+	classes[spec.Class] = spec
+	return nil
+}
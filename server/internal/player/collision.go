@@ -0,0 +1,166 @@
+package player
+
+import (
+	"gitlab.com/resamvi/sennai/pkg/math"
+)
+
+const (
+	bodylength  = 59.0 // length of a car from bumper to bumper
+	bodywidth   = 30.0 // width of a car
+	restitution = 0.5  // how bouncy cars are when hitting each other (0 = not at all, 1 = perfectly elastic)
+	bounce      = 0.3  // how bouncy walls are
+	scrape      = 0.8  // share of speed along a wall that is kept when scraping it
+)
+
+// body returns the line through the middle of the car along its heading.
+// Together with a radius of half the car's width it forms the capsule the car's body consists of
+func (p Player) body() math.Segment {
+	half := p.direction()
+	half.Scale((bodylength - bodywidth) / 2)
+
+	front, rear := math.Point{X: p.X, Y: p.Y}, math.Point{X: p.X, Y: p.Y}
+	front.MoveBy(half)
+	rear.MoveBy(half.Opposite())
+
+	return math.Segment{A: rear, B: front}
+}
+
+// Collide pushes two overlapping cars apart and exchanges their momentum
+// along the contact normal. It reports whether the cars touched
+func Collide(a, b *Player) bool {
+	pa, pb := a.body().ClosestPoints(b.body())
+
+	normal := math.VectorFromTo(pa, pb)
+	dist := normal.Len()
+	if dist >= bodywidth {
+		return false
+	}
+
+	if dist == 0 {
+		// Bodies overlap exactly so separate them from center to center (or sideways as last resort)
+		normal = math.VectorFromTo(math.Point{X: a.X, Y: a.Y}, math.Point{X: b.X, Y: b.Y})
+		if normal.Len() == 0 {
+			normal = a.direction()
+			normal.Rotate(90)
+		}
+	}
+	normal.Normalize()
+
+	// Separate the bodies with the lighter car moving further
+	ia, ib := 1/a.Car.Mass, 1/b.Car.Mass
+	overlap := (bodywidth - dist) / (ia + ib)
+
+	a.X, a.Y = a.X-normal.X*overlap*ia, a.Y-normal.Y*overlap*ia
+	b.X, b.Y = b.X+normal.X*overlap*ib, b.Y+normal.Y*overlap*ib
+
+	// Only exchange momentum if the cars move towards each other
+	closing := b.Velocity
+	closing.Add(a.Velocity.Opposite())
+
+	approach := closing.Dot(normal)
+	if approach >= 0 {
+		return true
+	}
+
+	j := -(1 + restitution) * approach / (ia + ib)
+
+	impulse := normal
+	impulse.Scale(j)
+
+	a.Velocity.X, a.Velocity.Y = a.Velocity.X-impulse.X*ia, a.Velocity.Y-impulse.Y*ia
+	b.Velocity.X, b.Velocity.Y = b.Velocity.X+impulse.X*ib, b.Velocity.Y+impulse.Y*ib
+
+	return true
+}
+
+// HitWalls keeps the car on the inside of the walls after it moved away from `from`.
+// A car that tunneled through a wall within one game cycle is put back to where it crossed it.
+// Cars touching a wall bounce off of it and lose speed scraping along it.
+// Every new contact with a wall is counted in WallHits
+func (p *Player) HitWalls(from math.Point, walls []math.Segment) bool {
+	hit := false
+
+	// Swept check so fast cars can not skip over a wall
+	path := math.Segment{A: from, B: math.Point{X: p.X, Y: p.Y}}
+	for _, w := range walls {
+		at, ok := path.Intersect(w)
+		if !ok {
+			continue
+		}
+
+		normal := facing(w, from)
+		back := normal
+		back.Scale(bodywidth / 2)
+		at.MoveBy(back)
+
+		p.X, p.Y = at.X, at.Y
+		p.deflect(normal)
+		hit = true
+
+		path.B = at
+	}
+
+	// Push the body out of every wall it overlaps with
+	for _, w := range walls {
+		pb, pw := p.body().ClosestPoints(w)
+
+		normal := math.VectorFromTo(pw, pb)
+		dist := normal.Len()
+		if dist >= bodywidth/2 {
+			continue
+		}
+
+		if dist == 0 {
+			normal = facing(w, from)
+		}
+		normal.Normalize()
+
+		push := normal
+		push.Scale(bodywidth/2 - dist)
+		p.X, p.Y = p.X+push.X, p.Y+push.Y
+
+		p.deflect(normal)
+		hit = true
+	}
+
+	if hit && !p.walled {
+		p.WallHits++
+	}
+	p.walled = hit
+
+	return hit
+}
+
+// deflect bounces the car off of a wall facing into the direction of `normal`
+func (p *Player) deflect(normal math.Vector) {
+	into := p.Velocity.Dot(normal)
+	if into >= 0 {
+		return
+	}
+
+	along := normal
+	along.Scale(into)
+
+	tangent := p.Velocity
+	tangent.Add(along.Opposite())
+	tangent.Scale(scrape)
+
+	away := normal
+	away.Scale(-into * bounce)
+
+	tangent.Add(away)
+	p.Velocity = tangent
+}
+
+// facing returns the unit normal of the wall pointing to the side of the wall p is on
+func facing(w math.Segment, p math.Point) math.Vector {
+	normal := math.VectorFromTo(w.A, w.B)
+	normal.Rotate(90)
+	normal.Normalize()
+
+	if w.Side(p) < 0 {
+		return normal.Opposite()
+	}
+
+	return normal
+}
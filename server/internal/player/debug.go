@@ -2,41 +2,65 @@ package player
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 )
 
-// ChangeVar can set physics constants via http for debug purposes
+// ChangeVar can set physics constants of a car class via http for debug purposes.
+// The class is picked by the `class` query parameter (defaults to standard)
+// and cars pick up the changes the next time they choose the class
 func ChangeVar(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("class")
+	if name == "" {
+		name = Standard.Class
+	}
+
+	spec, ok := Class(name)
+	if !ok {
+		spec = Standard
+		spec.Class = name
+	}
+
 	for k, v := range r.URL.Query() {
+		if k == "class" {
+			continue
+		}
 
 		i, err := strconv.ParseFloat(v[0], 64)
 		if err != nil {
-			log.Fatal("ChangeVar: " + err.Error())
+			http.Error(w, k+": "+err.Error(), http.StatusBadRequest)
+			return
 		}
 
 		switch k {
 		case "turnspeed":
-			turnspeed = i
+			spec.TurnSpeed = i
 		case "wheelbase":
-			wheelbase = i
+			spec.Wheelbase = i
 		case "enginepower":
-			enginepower = i
+			spec.EnginePower = i
 		case "brakepower":
-			brakepower = i
+			spec.BrakePower = i
 		case "offtrackfriction":
-			offtrackfriction = i
+			spec.OffTrackFriction = i
 		case "ontrackfriction":
-			ontrackfriction = i
+			spec.OnTrackFriction = i
 		case "drag":
-			drag = i
+			spec.Drag = i
 		case "traction":
-			traction = i
+			spec.Traction = i
+		case "mass":
+			spec.Mass = i
 		default:
 			fmt.Println("unknown key: " + k)
+			continue
 		}
 
-		fmt.Printf("Set %s to %f", k, i)
+		fmt.Printf("Set %s of %s to %f\n", k, name, i)
+	}
+
+	err := SetClass(spec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 	}
 }
@@ -4,116 +4,148 @@ import (
 	"fmt"
 	"time"
 
+	"gitlab.com/resamvi/sennai/internal/timing"
 	"gitlab.com/resamvi/sennai/pkg/math"
 )
 
-// Input represents the currently pressed arrow keys of a player
+// Input represents the controls of a player either as pressed arrow keys
+// or as analog values (e.g. of a gamepad or an AI agent)
 type Input struct {
-	Left  bool `json:"left"`
-	Right bool `json:"right"`
-	Up    bool `json:"up"`
-	Down  bool `json:"down"`
+	Left     bool    `json:"left"`
+	Right    bool    `json:"right"`
+	Up       bool    `json:"up"`
+	Down     bool    `json:"down"`
+	Steer    float64 `json:"steer,omitempty"`    // -1 (full left) to 1 (full right)
+	Throttle float64 `json:"throttle,omitempty"` // 0 to 1
+	Brake    float64 `json:"brake,omitempty"`    // 0 to 1
+	Seq      uint32  `json:"seq,omitempty"`      // sequence number the client tagged the input with
+}
+
+// Controls returns the steering in [-1, 1] as well as throttle and brake in [0, 1].
+// Pressed arrow keys take precedence over the analog values
+func (i Input) Controls() (steer, throttle, brake float64) {
+	steer = math.Clamp(i.Steer, -1, 1)
+	throttle = math.Clamp(i.Throttle, 0, 1)
+	brake = math.Clamp(i.Brake, 0, 1)
+
+	if i.Left {
+		steer = -1
+	} else if i.Right {
+		steer = 1
+	}
+
+	if i.Up {
+		throttle = 1
+	}
+
+	if i.Down {
+		brake = 1
+	}
+
+	return steer, throttle, brake
 }
 
 // Player represents a connected player
 type Player struct {
-	Name       string  `json:"name"`
-	ID         int     `json:"id"`
-	X          float64 `json:"x"`
-	Y          float64 `json:"y"`
-	Rotation   float64 `json:"rotation"`
-	Progress   float64 `json:"progress"` // Progress gives the progress in the range of 0 and 100
+	Name       string       `json:"name"`
+	ID         int          `json:"id"`
+	X          float64      `json:"x"`
+	Y          float64      `json:"y"`
+	Rotation   float64      `json:"rotation"`
+	Progress   float64      `json:"progress"` // Progress gives the progress in the range of 0 and 100
+	Timing     timing.Timer `json:"timing"`
 	FinishTime time.Duration
+	WallHits   int `json:"wallHits"` // WallHits counts how often the player ran into a wall
 	Input      Input
-	inside     []int // indices to points of the track that are in range of the player
-	velocity   math.Vector
-	passed     []bool
+	Car        CarSpec     `json:"-"`        // sent once with the initial setup instead of every update
+	Velocity   math.Vector `json:"velocity"` // distance moved per Step
+	LastSeq    uint32      `json:"lastSeq"`  // sequence number of the latest input that has been applied
+	Tick       int         `json:"tick"`     // game cycle the state was calculated in
+	inside     []int       // indices to points of the track that are in range of the player
+	walled     bool        // whether the player touched a wall in the last game cycle
 }
 
-var (
-	turnspeed        = 4.0     // amount that front wheel turns
-	wheelbase        = 40.0    // distance from front to rear wheel
-	enginepower      = 7.0     // power to accelerate
-	brakepower       = -2.0    // power to brake
-	ontrackfriction  = -0.06   // friction force applied by the asphalt ground
-	offtrackfriction = -0.3    // friction force applied by sand ground
-	drag             = -0.0015 // wind resistance
-	traction         = 0.00001 // drift factor (1 = basically on rails)
-	maxskip          = 30      // player may skip this many points by going offtrack
-)
-
-// New creates a new player pointing at the right direction on the track
-func New(id int, start math.Point, next math.Point, length int) Player {
+// New creates a new player placed at the starting position with the given rotation (in degrees) driving a standard car
+func New(id int, start math.Point, rotation float64) Player {
 	return Player{
 		Name:     "<Loading>",
 		ID:       id,
 		X:        start.X,
 		Y:        start.Y,
-		Rotation: math.VectorFromTo(start, next).Angle(),
+		Rotation: rotation,
 		Progress: 0,
 		Input:    Input{Left: false, Right: false, Up: false, Down: false},
-		passed:   make([]bool, length),
+		Car:      Standard,
 	}
 }
 
-// Update will calculate the next position of
-// the player to be shown on the next game cycle
+// Step is the time step car specs are tuned for.
+// Velocities are given in distance per Step
+const Step = 30 * time.Millisecond
+
+// Update will calculate the next position of the player after `dt` passed.
+// `points` are the indices of the track's center line that are in range of the player
 // https://engineeringdotnet.blogspot.com/2010/04/simple-2d-car-physics-in-games.html
-func (p *Player) Update(points []int) {
-	p.physics()
-	p.progress(points)
+func (p *Player) Update(points []int, dt time.Duration) {
+	p.physics(float64(dt) / float64(Step))
+	p.inside = points
 }
 
-// Reset teleports and alignts the player back to the track
-func (p *Player) Reset(start math.Point, next math.Point, length int) {
+// Reset teleports and aligns the player back to the starting position
+func (p *Player) Reset(start math.Point, rotation float64) {
 	p.X = start.X
 	p.Y = start.Y
 	p.Progress = 0
-	p.Rotation = math.VectorFromTo(start, next).Angle()
-	p.passed = make([]bool, length)
+	p.Timing = timing.Timer{}
+	p.FinishTime = 0
+	p.WallHits = 0
+	p.walled = false
+	p.Rotation = rotation
+	p.Velocity = math.Vector{}
+	p.inside = nil
 }
 
-func (p *Player) physics() {
+// physics moves the car by `scale` steps
+func (p *Player) physics(scale float64) {
 	// Translate input
-	steerangle := 0.0
-	if p.Input.Left {
-		steerangle = -turnspeed
-	} else if p.Input.Right {
-		steerangle = turnspeed
-	}
+	steer, throttle, brake := p.Input.Controls()
+	steerangle := steer * p.Car.TurnSpeed
 
 	acceleration := math.Vector{X: 0, Y: 0}
-	if p.Input.Up {
+	if throttle > 0 {
 		acceleration = p.direction()
-		acceleration.Scale(enginepower)
+		acceleration.Scale(p.Car.EnginePower * throttle)
 	}
 
-	if p.Input.Down {
+	// Braking overrides the throttle
+	if brake > 0 {
 		acceleration = p.direction()
-		acceleration.Scale(brakepower)
+		acceleration.Scale(p.Car.BrakePower * brake)
 	}
 
 	// Apply drag and friction
-	frictionForce := p.velocity
-	if p.isOffroad() {
-		frictionForce.Scale(offtrackfriction)
+	frictionForce := p.Velocity
+	if p.Offroad() {
+		frictionForce.Scale(p.Car.OffTrackFriction)
 	} else {
-		frictionForce.Scale(ontrackfriction)
+		frictionForce.Scale(p.Car.OnTrackFriction)
 	}
 
-	dragForce := p.velocity
-	dragForce.Scale(p.velocity.Len() * drag)
+	dragForce := p.Velocity
+	dragForce.Scale(p.Velocity.Len() * p.Car.Drag)
 
 	acceleration.Add(frictionForce)
 	acceleration.Add(dragForce)
+	acceleration.Scale(scale)
 
-	p.velocity.Add(acceleration)
+	p.Velocity.Add(acceleration)
 
 	// Calculate next position
-	frontWheel := math.Point{X: p.X + math.Cos(p.Rotation)*(wheelbase/2), Y: p.Y + math.Sin(p.Rotation)*(wheelbase/2)}
-	rearWheel := math.Point{X: p.X + math.Cos(p.Rotation)*(-wheelbase/2), Y: p.Y + math.Sin(p.Rotation)*(-wheelbase/2)}
+	frontWheel := math.Point{X: p.X + math.Cos(p.Rotation)*(p.Car.Wheelbase/2), Y: p.Y + math.Sin(p.Rotation)*(p.Car.Wheelbase/2)}
+	rearWheel := math.Point{X: p.X + math.Cos(p.Rotation)*(-p.Car.Wheelbase/2), Y: p.Y + math.Sin(p.Rotation)*(-p.Car.Wheelbase/2)}
 
-	cpy := p.velocity
+	cpy := p.Velocity
+	cpy.Scale(scale)
 	rearWheel.Add(cpy)
 
 	cpy.Rotate(steerangle) // Apply steering to front wheel
@@ -121,50 +153,21 @@ func (p *Player) physics() {
 
 	newHeading := math.Vector{X: frontWheel.X - rearWheel.X, Y: frontWheel.Y - rearWheel.Y}
 	newHeading.Normalize()
-	newHeading.Scale(p.velocity.Len())
+	newHeading.Scale(p.Velocity.Len())
 
-	p.velocity = math.InterpolateVector(p.velocity, newHeading, traction)
+	p.Velocity = math.InterpolateVector(p.Velocity, newHeading, 1-math.Pow(1-p.Car.Traction, scale))
 
 	// Do not allow reversing
-	if p.velocity.Dot(newHeading) < 0 {
-		p.velocity.Scale(0)
+	if p.Velocity.Dot(newHeading) < 0 {
+		p.Velocity.Scale(0)
 	}
 
 	// Move
 	if newHeading.Len() != 0 {
 		p.Rotation = newHeading.Angle()
 	}
-	p.X += p.velocity.X
-	p.Y += p.velocity.Y
-}
-
-// get a list of indexes into the track slice that we mark as "passed" to track progress
-func (p *Player) progress(points []int) {
-	for _, v := range points {
-		p.passed[v] = true
-	}
-
-	p.inside = points
-	p.Progress = math.Floor((p.furthest() / float64(len(p.passed)-1)) * 100)
-}
-
-// TODO: Fix ending
-func (p Player) furthest() float64 {
-	max, skipped := 0, 0
-	for i := 0; i < len(p.passed); i++ {
-		if p.passed[i] {
-			max = i
-			skipped = 0
-		} else {
-			skipped++
-		}
-
-		if skipped > maxskip {
-			break
-		}
-	}
-
-	return float64(max)
+	p.X += p.Velocity.X * scale
+	p.Y += p.Velocity.Y * scale
 }
 
 // direction returns a vector pointing into the direction
@@ -175,10 +178,16 @@ func (p Player) direction() math.Vector {
 	return v
 }
 
-func (p Player) isOffroad() bool {
+// Offroad reports whether the player has left the track
+func (p Player) Offroad() bool {
 	return len(p.inside) == 0
 }
 
+// Speed returns the distance the player moves per game cycle
+func (p Player) Speed() float64 {
+	return p.Velocity.Len()
+}
+
 func (p Player) String() string {
 	return fmt.Sprintf("[%d.: %s - (%.1f, %.1f) %.1f° %.1f%%", p.ID, p.Name, p.X, p.Y, p.Rotation, p.Progress)
 }
@@ -0,0 +1,135 @@
+package player
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/resamvi/sennai/pkg/math"
+)
+
+func TestControls(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    Input
+		steer    float64
+		throttle float64
+		brake    float64
+	}{
+		{"nothing pressed", Input{}, 0, 0, 0},
+		{"arrow keys", Input{Left: true, Up: true}, -1, 1, 0},
+		{"left wins over right", Input{Left: true, Right: true}, -1, 0, 0},
+		{"analog", Input{Steer: 0.25, Throttle: 0.5, Brake: 0.1}, 0.25, 0.5, 0.1},
+		{"analog out of range", Input{Steer: -3, Throttle: 2, Brake: -1}, -1, 1, 0},
+		{"keys override analog", Input{Right: true, Down: true, Steer: -0.5, Brake: 0.2}, 1, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steer, throttle, brake := tt.input.Controls()
+			if steer != tt.steer || throttle != tt.throttle || brake != tt.brake {
+				t.Errorf("got (%.2f, %.2f, %.2f), want (%.2f, %.2f, %.2f)", steer, throttle, brake, tt.steer, tt.throttle, tt.brake)
+			}
+		})
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite the recorded drive in testdata/physics.json")
+
+// drive is a recorded drive on asphalt that clients predicting cars (see client/src/physics.ts) can compare with
+type drive struct {
+	Car   CarSpec       `json:"car"`
+	Dt    time.Duration `json:"dt"` // in ns
+	Steps []driveStep   `json:"steps"`
+}
+
+type driveStep struct {
+	Input    Input       `json:"input"`
+	X        float64     `json:"x"`
+	Y        float64     `json:"y"`
+	Rotation float64     `json:"rotation"`
+	Velocity math.Vector `json:"velocity"`
+}
+
+func TestPhysicsSpec(t *testing.T) {
+	inputs := []struct {
+		input Input
+		times int
+	}{
+		{Input{Up: true}, 20},
+		{Input{Up: true, Right: true}, 10},
+		{Input{Steer: -0.5, Throttle: 0.7}, 10},
+		{Input{Down: true}, 10},
+	}
+
+	got := drive{Car: Standard, Dt: Step}
+	p := New(0, math.Point{X: 100, Y: 200}, 30)
+	for _, in := range inputs {
+		for i := 0; i < in.times; i++ {
+			p.Input = in.input
+			p.Update([]int{0}, Step)
+
+			got.Steps = append(got.Steps, driveStep{Input: in.input, X: p.X, Y: p.Y, Rotation: p.Rotation, Velocity: p.Velocity})
+		}
+	}
+
+	path := filepath.Join("testdata", "physics.json")
+	if *update {
+		data, err := json.MarshalIndent(got, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(path, data, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want drive
+	err = json.Unmarshal(data, &want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Car != want.Car || got.Dt != want.Dt || len(got.Steps) != len(want.Steps) {
+		t.Fatalf("physics changed: update client/src/physics.ts and rerun with -update")
+	}
+
+	// Floats are compared with a tolerance since some architectures fuse multiply-adds
+	for i, g := range got.Steps {
+		w := want.Steps[i]
+		if g.Input != w.Input || !near(g.X, w.X) || !near(g.Y, w.Y) || !near(g.Rotation, w.Rotation) ||
+			!near(g.Velocity.X, w.Velocity.X) || !near(g.Velocity.Y, w.Velocity.Y) {
+			t.Fatalf("physics changed at step %d: got %+v, want %+v (update client/src/physics.ts and rerun with -update)", i, g, w)
+		}
+	}
+}
+
+// near reports whether a and b are equal up to rounding errors
+func near(a, b float64) bool {
+	const epsilon = 1e-9
+
+	d := a - b
+	if d < 0 {
+		d = -d
+	}
+
+	scale := b
+	if scale < 0 {
+		scale = -scale
+	}
+	if scale < 1 {
+		scale = 1
+	}
+
+	return d <= epsilon*scale
+}
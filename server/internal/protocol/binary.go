@@ -0,0 +1,150 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Subprotocols a client can ask for when opening the websocket connection.
+// Clients that ask for none are sent the JSON form
+const (
+	JSONProtocol   = "sennai.json"   // every message is a text frame `<prefix>|<json>`
+	BinaryProtocol = "sennai.binary" // every message is a binary frame `<code><payload>`
+)
+
+// codes are the message types of binary frames. The code of a prefix is its index
+// so new prefixes must only be appended (mirrored in client/src/protocol.ts)
+var codes = []string{INIT, UPDATE, JOIN, LEAVE, TRACK, COUNTDOWN, CLOSEDOWN, BESTLIST, REST, SENSORS, DELTA, ERROR, SHUTDOWN}
+
+// code returns the message type byte of a prefix
+func code(prefix string) (byte, bool) {
+	for i, c := range codes {
+		if c == prefix {
+			return byte(i), true
+		}
+	}
+
+	return 0, false
+}
+
+// Car is the state of a car as it is sent in binary updates and deltas
+type Car struct {
+	ID       int
+	Name     string // only sent in deltas
+	X        float64
+	Y        float64
+	Rotation float64 // in degrees
+	Progress float64 // in the range of 0 and 100
+	LastSeq  uint32  // sequence number of the latest input that has been applied
+	VX       float64 // velocity
+	VY       float64
+}
+
+const (
+	carsize    = 21  // bytes per car: id (2), x (4), y (4), rotation (2), progress (1), last seq (4), velocity (2 + 2)
+	precision  = 10  // positions are sent in 1/precision units
+	vprecision = 100 // velocities are sent in 1/vprecision units
+)
+
+// ErrMalformed is returned when decoding a binary payload that is cut off
+var ErrMalformed = errors.New("malformed binary payload")
+
+// EncodeUpdate packs the cars into the payload of a binary update.
+// It starts with the game cycle the state was calculated in (uint32) and the amount of cars (uint16)
+// followed by the cars in a fixed layout (little endian).
+// Positions are quantized to a tenth of a unit, rotations to 1/65536 of a turn,
+// progress to whole percents and velocities to a hundredth of a unit
+func EncodeUpdate(tick uint32, cars []Car) []byte {
+	buf := make([]byte, 6+len(cars)*carsize)
+	binary.LittleEndian.PutUint32(buf, tick)
+	binary.LittleEndian.PutUint16(buf[4:], uint16(len(cars)))
+
+	for i, c := range cars {
+		b := buf[6+i*carsize:]
+
+		binary.LittleEndian.PutUint16(b[0:], uint16(c.ID))
+		binary.LittleEndian.PutUint32(b[2:], uint32(position(c.X)))
+		binary.LittleEndian.PutUint32(b[6:], uint32(position(c.Y)))
+		binary.LittleEndian.PutUint16(b[10:], rotation(c.Rotation))
+		b[12] = progress(c.Progress)
+		binary.LittleEndian.PutUint32(b[13:], c.LastSeq)
+		binary.LittleEndian.PutUint16(b[17:], uint16(velocity(c.VX)))
+		binary.LittleEndian.PutUint16(b[19:], uint16(velocity(c.VY)))
+	}
+
+	return buf
+}
+
+// DecodeUpdate unpacks the payload of a binary update
+func DecodeUpdate(buf []byte) (uint32, []Car, error) {
+	if len(buf) < 6 {
+		return 0, nil, ErrMalformed
+	}
+
+	tick := binary.LittleEndian.Uint32(buf)
+	n := int(binary.LittleEndian.Uint16(buf[4:]))
+	if len(buf) < 6+n*carsize {
+		return 0, nil, ErrMalformed
+	}
+
+	cars := make([]Car, n)
+	for i := range cars {
+		b := buf[6+i*carsize:]
+
+		cars[i] = Car{
+			ID:       int(binary.LittleEndian.Uint16(b[0:])),
+			X:        float64(int32(binary.LittleEndian.Uint32(b[2:]))) / precision,
+			Y:        float64(int32(binary.LittleEndian.Uint32(b[6:]))) / precision,
+			Rotation: float64(binary.LittleEndian.Uint16(b[10:])) * 360 / 65536,
+			Progress: float64(b[12]),
+			LastSeq:  binary.LittleEndian.Uint32(b[13:]),
+			VX:       float64(int16(binary.LittleEndian.Uint16(b[17:]))) / vprecision,
+			VY:       float64(int16(binary.LittleEndian.Uint16(b[19:]))) / vprecision,
+		}
+	}
+
+	return tick, cars, nil
+}
+
+// position quantizes a coordinate
+func position(x float64) int32 {
+	return int32(math.Round(x * precision))
+}
+
+// rotation quantizes an angle to 1/65536 of a turn
+func rotation(alpha float64) uint16 {
+	return uint16(int(math.Round(turn(alpha)*65536/360)) % 65536)
+}
+
+// progress quantizes the progress to whole percents
+func progress(p float64) byte {
+	return byte(math.Max(0, math.Min(100, p)))
+}
+
+// velocity quantizes a component of a velocity
+func velocity(v float64) int16 {
+	return int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(v*vprecision))))
+}
+
+// quantize rounds the car's state to what the binary encoding is able to transfer
+func quantize(c Car) Car {
+	c.X = float64(position(c.X)) / precision
+	c.Y = float64(position(c.Y)) / precision
+	c.Rotation = float64(rotation(c.Rotation)) * 360 / 65536
+	c.Progress = float64(progress(c.Progress))
+	c.VX = float64(velocity(c.VX)) / vprecision
+	c.VY = float64(velocity(c.VY)) / vprecision
+
+	return c
+}
+
+// turn maps an angle to the range of [0, 360)
+func turn(alpha float64) float64 {
+	alpha = math.Mod(alpha, 360)
+	if alpha < 0 {
+		alpha += 360
+	}
+
+	return alpha
+}
@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestEncodeUpdate(t *testing.T) {
+	cars := []Car{
+		{ID: 0, X: 1234.56, Y: -78.91, Rotation: 90, Progress: 42, LastSeq: 17, VX: 12.345, VY: -0.5},
+		{ID: 7, X: -0.04, Y: 99999.99, Rotation: -45, Progress: 100},
+		{ID: 3, X: 0, Y: 0, Rotation: 359.999, Progress: 0, LastSeq: 1 << 31},
+	}
+
+	tick, got, err := DecodeUpdate(EncodeUpdate(1234, cars))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tick != 1234 {
+		t.Errorf("got tick %d, want 1234", tick)
+	}
+
+	if len(got) != len(cars) {
+		t.Fatalf("got %d cars, want %d", len(got), len(cars))
+	}
+
+	for i, want := range cars {
+		c := got[i]
+
+		rotation := math.Abs(turn(c.Rotation-want.Rotation+180) - 180)
+		if c.ID != want.ID || math.Abs(c.X-want.X) > 0.05 || math.Abs(c.Y-want.Y) > 0.05 || rotation > 0.01 || c.Progress != want.Progress ||
+			c.LastSeq != want.LastSeq || math.Abs(c.VX-want.VX) > 0.005 || math.Abs(c.VY-want.VY) > 0.005 {
+			t.Errorf("got %+v, want %+v", c, want)
+		}
+	}
+
+	if _, _, err := DecodeUpdate(EncodeUpdate(0, cars)[:30]); err != ErrMalformed {
+		t.Errorf("got error %v for cut off payload, want %v", err, ErrMalformed)
+	}
+}
+
+func TestSubprotocol(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteMessage(COUNTDOWN, []byte("3"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		subprotocols []string
+		typ          int
+		message      string
+	}{
+		{"no subprotocol", nil, websocket.TextMessage, "count|3"},
+		{"json", []string{JSONProtocol}, websocket.TextMessage, "count|3"},
+		{"binary", []string{BinaryProtocol, JSONProtocol}, websocket.BinaryMessage, "\x053"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialer := websocket.Dialer{Subprotocols: tt.subprotocols}
+			header := http.Header{"Origin": []string{"http://localhost:7999"}}
+
+			conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			typ, message, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if typ != tt.typ || string(message) != tt.message {
+				t.Errorf("got frame %d %q, want %d %q", typ, message, tt.typ, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,378 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// keyframe is the amount of snapshots after which a full snapshot is sent even if the client acknowledged
+	keyframe = 60
+
+	// history is the amount of snapshots kept until they are acknowledged. Clients have to keep at least as many
+	history = 64
+)
+
+// Fields of a car that changed in a delta
+const (
+	FieldX byte = 1 << iota
+	FieldY
+	FieldRotation
+	FieldProgress
+	FieldName
+	FieldSeq
+	FieldVelocity
+)
+
+// Snapshot is the state of every car (quantized as it is transferred) at a point in time
+type Snapshot struct {
+	Seq  uint32
+	Tick uint32 // game cycle the state was calculated in
+	Cars map[int]Car
+}
+
+// Delta are the changes of a snapshot compared to a snapshot the client already has.
+// A Delta with a Base of 0 is a keyframe containing every field of every car
+type Delta struct {
+	Seq     uint32      `json:"seq"`
+	Base    uint32      `json:"base"`
+	Tick    uint32      `json:"tick"`
+	Cars    []CarChange `json:"cars"`
+	Removed []int       `json:"removed"`
+}
+
+// CarChange are the fields of a car that changed
+type CarChange struct {
+	Car
+	Fields byte // bitmask of the Field constants
+}
+
+// Diff returns the changes from the base to the next snapshot.
+// Diffing against an empty base results in a keyframe
+func Diff(base, next Snapshot) Delta {
+	d := Delta{Seq: next.Seq, Base: base.Seq, Tick: next.Tick, Cars: make([]CarChange, 0), Removed: make([]int, 0)}
+
+	for _, id := range ids(next.Cars) {
+		c := next.Cars[id]
+		old, ok := base.Cars[id]
+
+		change := CarChange{Car: c}
+		if !ok || old.X != c.X {
+			change.Fields |= FieldX
+		}
+		if !ok || old.Y != c.Y {
+			change.Fields |= FieldY
+		}
+		if !ok || old.Rotation != c.Rotation {
+			change.Fields |= FieldRotation
+		}
+		if !ok || old.Progress != c.Progress {
+			change.Fields |= FieldProgress
+		}
+		if !ok || old.Name != c.Name {
+			change.Fields |= FieldName
+		}
+		if !ok || old.LastSeq != c.LastSeq {
+			change.Fields |= FieldSeq
+		}
+		if !ok || old.VX != c.VX || old.VY != c.VY {
+			change.Fields |= FieldVelocity
+		}
+
+		if change.Fields != 0 {
+			d.Cars = append(d.Cars, change)
+		}
+	}
+
+	for _, id := range ids(base.Cars) {
+		if _, ok := next.Cars[id]; !ok {
+			d.Removed = append(d.Removed, id)
+		}
+	}
+
+	return d
+}
+
+// Apply returns the snapshot that results from applying the delta to its base
+func Apply(base Snapshot, d Delta) Snapshot {
+	result := Snapshot{Seq: d.Seq, Tick: d.Tick, Cars: make(map[int]Car, len(base.Cars))}
+	for id, c := range base.Cars {
+		result.Cars[id] = c
+	}
+
+	for _, id := range d.Removed {
+		delete(result.Cars, id)
+	}
+
+	for _, change := range d.Cars {
+		c := result.Cars[change.ID]
+		c.ID = change.ID
+
+		if change.Fields&FieldX != 0 {
+			c.X = change.X
+		}
+		if change.Fields&FieldY != 0 {
+			c.Y = change.Y
+		}
+		if change.Fields&FieldRotation != 0 {
+			c.Rotation = change.Rotation
+		}
+		if change.Fields&FieldProgress != 0 {
+			c.Progress = change.Progress
+		}
+		if change.Fields&FieldName != 0 {
+			c.Name = change.Name
+		}
+		if change.Fields&FieldSeq != 0 {
+			c.LastSeq = change.LastSeq
+		}
+		if change.Fields&FieldVelocity != 0 {
+			c.VX, c.VY = change.VX, change.VY
+		}
+
+		result.Cars[change.ID] = c
+	}
+
+	return result
+}
+
+// MarshalJSON only writes the fields that changed
+func (c CarChange) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{"id": c.ID}
+
+	if c.Fields&FieldX != 0 {
+		m["x"] = c.X
+	}
+	if c.Fields&FieldY != 0 {
+		m["y"] = c.Y
+	}
+	if c.Fields&FieldRotation != 0 {
+		m["rotation"] = c.Rotation
+	}
+	if c.Fields&FieldProgress != 0 {
+		m["progress"] = c.Progress
+	}
+	if c.Fields&FieldName != 0 {
+		m["name"] = c.Name
+	}
+	if c.Fields&FieldSeq != 0 {
+		m["lastSeq"] = c.LastSeq
+	}
+	if c.Fields&FieldVelocity != 0 {
+		m["velocity"] = map[string]float64{"x": c.VX, "y": c.VY}
+	}
+
+	return json.Marshal(m)
+}
+
+// EncodeDelta packs a delta into the payload of a binary frame (little endian):
+// seq, base and tick (uint32), amount of changed cars (uint16) followed by every changed car as
+// id (uint16), fields (uint8) and the changed fields in the order x, y (int32), rotation (uint16),
+// progress (uint8), name (uint8 length + UTF-8), last seq (uint32), velocity (2 int16),
+// then the amount of removed cars (uint16) and their ids (uint16)
+func EncodeDelta(d Delta) []byte {
+	buf := make([]byte, 14, 14+len(d.Cars)*carsize+2+len(d.Removed)*2)
+	binary.LittleEndian.PutUint32(buf[0:], d.Seq)
+	binary.LittleEndian.PutUint32(buf[4:], d.Base)
+	binary.LittleEndian.PutUint32(buf[8:], d.Tick)
+	binary.LittleEndian.PutUint16(buf[12:], uint16(len(d.Cars)))
+
+	var scratch [4]byte
+	for _, c := range d.Cars {
+		binary.LittleEndian.PutUint16(scratch[:], uint16(c.ID))
+		buf = append(buf, scratch[0], scratch[1], c.Fields)
+
+		if c.Fields&FieldX != 0 {
+			binary.LittleEndian.PutUint32(scratch[:], uint32(position(c.X)))
+			buf = append(buf, scratch[:4]...)
+		}
+		if c.Fields&FieldY != 0 {
+			binary.LittleEndian.PutUint32(scratch[:], uint32(position(c.Y)))
+			buf = append(buf, scratch[:4]...)
+		}
+		if c.Fields&FieldRotation != 0 {
+			binary.LittleEndian.PutUint16(scratch[:], rotation(c.Rotation))
+			buf = append(buf, scratch[:2]...)
+		}
+		if c.Fields&FieldProgress != 0 {
+			buf = append(buf, progress(c.Progress))
+		}
+		if c.Fields&FieldName != 0 {
+			name := truncate(c.Name, 255)
+			buf = append(buf, byte(len(name)))
+			buf = append(buf, name...)
+		}
+		if c.Fields&FieldSeq != 0 {
+			binary.LittleEndian.PutUint32(scratch[:], c.LastSeq)
+			buf = append(buf, scratch[:4]...)
+		}
+		if c.Fields&FieldVelocity != 0 {
+			binary.LittleEndian.PutUint16(scratch[0:], uint16(velocity(c.VX)))
+			binary.LittleEndian.PutUint16(scratch[2:], uint16(velocity(c.VY)))
+			buf = append(buf, scratch[:4]...)
+		}
+	}
+
+	binary.LittleEndian.PutUint16(scratch[:], uint16(len(d.Removed)))
+	buf = append(buf, scratch[:2]...)
+	for _, id := range d.Removed {
+		binary.LittleEndian.PutUint16(scratch[:], uint16(id))
+		buf = append(buf, scratch[:2]...)
+	}
+
+	return buf
+}
+
+// DecodeDelta unpacks the payload of a binary delta
+func DecodeDelta(buf []byte) (Delta, error) {
+	r := reader{buf: buf}
+
+	d := Delta{Seq: r.uint32(), Base: r.uint32(), Tick: r.uint32()}
+
+	n := int(r.uint16())
+	d.Cars = make([]CarChange, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		c := CarChange{Car: Car{ID: int(r.uint16())}, Fields: r.byte()}
+
+		if c.Fields&FieldX != 0 {
+			c.X = float64(int32(r.uint32())) / precision
+		}
+		if c.Fields&FieldY != 0 {
+			c.Y = float64(int32(r.uint32())) / precision
+		}
+		if c.Fields&FieldRotation != 0 {
+			c.Rotation = float64(r.uint16()) * 360 / 65536
+		}
+		if c.Fields&FieldProgress != 0 {
+			c.Progress = float64(r.byte())
+		}
+		if c.Fields&FieldName != 0 {
+			c.Name = string(r.bytes(int(r.byte())))
+		}
+		if c.Fields&FieldSeq != 0 {
+			c.LastSeq = r.uint32()
+		}
+		if c.Fields&FieldVelocity != 0 {
+			c.VX = float64(int16(r.uint16())) / vprecision
+			c.VY = float64(int16(r.uint16())) / vprecision
+		}
+
+		d.Cars = append(d.Cars, c)
+	}
+
+	n = int(r.uint16())
+	d.Removed = make([]int, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		d.Removed = append(d.Removed, int(r.uint16()))
+	}
+
+	return d, r.err
+}
+
+// History keeps the snapshots sent to a client so that the next snapshot
+// can be sent as delta to the latest one the client acknowledged
+type History struct {
+	mu       sync.Mutex
+	seq      uint32
+	acked    uint32
+	sent     [history]Snapshot // ring buffer indexed by seq
+	sinceKey int               // snapshots sent since the last keyframe
+}
+
+// NewHistory creates an empty history. The first snapshot is always sent as keyframe
+func NewHistory() *History {
+	return &History{}
+}
+
+// Next records the cars calculated in the game cycle `tick` as the next snapshot
+// and returns the changes compared to the snapshot the client acknowledged last
+func (h *History) Next(tick uint32, cars []Car) Delta {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	next := Snapshot{Seq: h.seq, Tick: tick, Cars: make(map[int]Car, len(cars))}
+	for _, c := range cars {
+		next.Cars[c.ID] = quantize(c)
+	}
+
+	base := Snapshot{}
+	if h.sinceKey < keyframe && h.acked != 0 && h.seq-h.acked < history {
+		base = h.sent[h.acked%history]
+	}
+
+	if base.Seq == 0 {
+		h.sinceKey = 0
+	}
+	h.sinceKey++
+
+	h.sent[h.seq%history] = next
+
+	return Diff(base, next)
+}
+
+// Ack marks a snapshot as received by the client
+func (h *History) Ack(seq uint32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if seq > h.acked && seq <= h.seq {
+		h.acked = seq
+	}
+}
+
+// ids returns the keys of the map sorted so deltas are deterministic
+func ids(cars map[int]Car) []int {
+	result := make([]int, 0, len(cars))
+	for id := range cars {
+		result = append(result, id)
+	}
+	sort.Ints(result)
+
+	return result
+}
+
+// truncate cuts the string to at most n bytes without splitting a rune
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+// reader reads little endian values from a buffer and remembers if it ran out of data
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil || len(r.buf) < n {
+		r.err = ErrMalformed
+		return make([]byte, n)
+	}
+
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	return r.bytes(1)[0]
+}
+
+func (r *reader) uint16() uint16 {
+	return binary.LittleEndian.Uint16(r.bytes(2))
+}
+
+func (r *reader) uint32() uint32 {
+	return binary.LittleEndian.Uint32(r.bytes(4))
+}
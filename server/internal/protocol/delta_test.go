@@ -0,0 +1,138 @@
+package protocol
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestHistory(t *testing.T) {
+	h := NewHistory()
+	received := map[uint32]Snapshot{0: {}}
+
+	cars := []Car{
+		{ID: 0, Name: "Senna", X: 10, Y: 20, Rotation: 90},
+		{ID: 1, Name: "Prost", X: 30, Y: 40, Rotation: 180},
+	}
+
+	tests := []struct {
+		name     string
+		move     func()
+		ack      bool
+		keyframe bool
+		changed  int // amount of cars in the delta
+	}{
+		{"first snapshot is a keyframe", func() {}, true, true, 2},
+		{"nothing changed", func() {}, true, false, 0},
+		{"one car moves", func() { cars[0].X += 5; cars[0].VX = 5; cars[0].LastSeq = 3 }, false, false, 1},
+		{"unacknowledged snapshots are not used as base", func() { cars[1].Y += 5 }, true, false, 2},
+		{"car leaves", func() { cars = cars[:1] }, true, false, 0},
+		{"car joins", func() { cars = append(cars, Car{ID: 4, Name: "Lauda"}) }, true, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.move()
+			d := h.Next(7, cars)
+
+			// Send it over the wire like a binary client would receive it
+			decoded, err := DecodeDelta(EncodeDelta(d))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			base, ok := received[decoded.Base]
+			if !ok {
+				t.Fatalf("delta is based on snapshot %d the client never acknowledged", decoded.Base)
+			}
+
+			got := Apply(base, decoded)
+			received[got.Seq] = got
+
+			if (decoded.Base == 0) != tt.keyframe {
+				t.Errorf("got base %d, want keyframe %v", decoded.Base, tt.keyframe)
+			}
+
+			if len(decoded.Cars) != tt.changed {
+				t.Errorf("got %d changed cars, want %d", len(decoded.Cars), tt.changed)
+			}
+
+			want := make(map[int]Car)
+			for _, c := range cars {
+				want[c.ID] = quantize(c)
+			}
+
+			if got.Tick != 7 || !reflect.DeepEqual(got.Cars, want) {
+				t.Errorf("got %+v, want %+v", got.Cars, want)
+			}
+
+			if tt.ack {
+				h.Ack(d.Seq)
+			}
+		})
+	}
+}
+
+func TestKeyframe(t *testing.T) {
+	h := NewHistory()
+	cars := []Car{{ID: 0, X: 1}}
+
+	keyframes := 0
+	for i := 0; i < 3*keyframe; i++ {
+		d := h.Next(uint32(i), cars)
+		h.Ack(d.Seq)
+
+		if d.Base == 0 {
+			keyframes++
+		}
+	}
+
+	if keyframes != 3 {
+		t.Errorf("got %d keyframes, want 3", keyframes)
+	}
+}
+
+func TestDeltaJSON(t *testing.T) {
+	d := Delta{Seq: 2, Base: 1, Tick: 9, Cars: []CarChange{{Car: Car{ID: 3, X: 1.5, Y: 7}, Fields: FieldX}}, Removed: []int{}}
+
+	got, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"seq":2,"base":1,"tick":9,"cars":[{"id":3,"x":1.5}],"removed":[]}`
+	if string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestEncodeLongName(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  int
+	}{
+		{"ascii", strings.Repeat("a", 300), 255},
+		{"rune at the limit", strings.Repeat("a", 254) + "é", 254},
+		{"multibyte", strings.Repeat("€", 100), 255},
+		{"short", "Senna", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Delta{Seq: 1, Cars: []CarChange{{Car: Car{ID: 1, Name: tt.input}, Fields: FieldName}}}
+
+			got, err := DecodeDelta(EncodeDelta(d))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			name := got.Cars[0].Name
+			if len(name) != tt.want || !utf8.ValidString(name) || !strings.HasPrefix(tt.input, name) {
+				t.Errorf("got %d bytes %q, want %d valid bytes", len(name), name, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gitlab.com/resamvi/sennai/internal/player"
+	"gitlab.com/resamvi/sennai/internal/sensor"
+)
+
+// Version of the protocol. Clients state the version they speak in their HELLO
+// and the server tells the one it speaks in INIT
+const Version = 1
+
+// Codes of an Error telling the client what went wrong
+const (
+	CodeMalformed = "malformed" // message is not structured as `<prefix>|<data>`
+	CodeUnknown   = "unknown"   // prefix is not known
+	CodeInvalid   = "invalid"   // payload can not be understood or its values are not allowed
+	CodeVersion   = "version"   // client speaks a version of the protocol the server does not
+	CodeLimit     = "limit"     // client sent too many messages that could not be handled and is disconnected
+)
+
+// Message is a message sent from the client (see Decode)
+type Message interface {
+	Prefix() string
+}
+
+// Hello introduces the client. Clients before version 1 only sent
+// the name as JSON string which is still accepted
+type Hello struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Car     string `json:"car,omitempty"` // car class (see player.Classes)
+}
+
+// Input is what the player is pressing right now
+type Input struct {
+	player.Input
+}
+
+// Sense configures the sensor readings the client wants to receive
+type Sense struct {
+	sensor.Config
+}
+
+// Ack acknowledges the sequence number of a delta
+type Ack struct {
+	Seq uint32
+}
+
+// Error is sent to the client (as ERROR) if a message of the client can not be handled
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (Hello) Prefix() string { return HELLO }
+func (Input) Prefix() string { return INPUT }
+func (Sense) Prefix() string { return SENSE }
+func (Ack) Prefix() string   { return ACK }
+func (Error) Prefix() string { return ERROR }
+
+// UnmarshalJSON accepts both forms of a hello
+func (h *Hello) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*h = Hello{}
+		return json.Unmarshal(data, &h.Name)
+	}
+
+	type plain Hello
+	return json.Unmarshal(data, (*plain)(h))
+}
+
+// MarshalJSON writes the sequence number as plain number
+func (a Ack) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.Seq)
+}
+
+// UnmarshalJSON reads the sequence number from a plain number
+func (a *Ack) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &a.Seq)
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Encode serializes a message to the text form `<prefix>|<json>`
+func Encode(m Message) ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(m.Prefix()+"|"), data...), nil
+}
+
+// Decode parses a message sent by the client. If it can not be handled
+// the returned error is an *Error that can be sent back to the client
+func Decode(message []byte) (Message, error) {
+	prefix, payload, err := Parse(message)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Message
+	switch prefix {
+	case HELLO:
+		var h Hello
+		err = json.Unmarshal(payload, &h)
+		if err == nil && h.Version > Version {
+			return nil, &Error{Code: CodeVersion, Message: fmt.Sprintf("server speaks version %d, client %d", Version, h.Version)}
+		}
+		m = h
+	case INPUT:
+		var in Input
+		err = json.Unmarshal(payload, &in)
+		m = in
+	case SENSE:
+		s := Sense{sensor.Default}
+		err = json.Unmarshal(payload, &s)
+		if err == nil {
+			err = s.Validate()
+		}
+		m = s
+	case ACK:
+		var a Ack
+		err = json.Unmarshal(payload, &a)
+		m = a
+	default:
+		return nil, &Error{Code: CodeUnknown, Message: fmt.Sprintf("unknown prefix %q", prefix)}
+	}
+
+	if err != nil {
+		return nil, &Error{Code: CodeInvalid, Message: prefix + ": " + err.Error()}
+	}
+
+	return m, nil
+}
+
+// Parse will split a message sent by the client into its prefix and payload.
+// The payload may contain `|` as only the first one separates
+func Parse(message []byte) (string, []byte, error) {
+	i := bytes.IndexByte(message, '|')
+	if i < 0 {
+		return "", nil, &Error{Code: CodeMalformed, Message: "missing | between prefix and payload"}
+	}
+
+	return string(message[:i]), message[i+1:], nil
+}
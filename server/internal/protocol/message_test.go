@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+
+	"gitlab.com/resamvi/sennai/internal/player"
+	"gitlab.com/resamvi/sennai/internal/sensor"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		want     Message
+		wantCode string
+	}{
+		{"hello name only", `hello|"Senna"`, Hello{Name: "Senna"}, ""},
+		{"hello with car", `hello|{"version":1,"name":"Senna","car":"drift"}`, Hello{Version: 1, Name: "Senna", Car: "drift"}, ""},
+		{"hello with pipe in name", `hello|"Sen|na"`, Hello{Name: "Sen|na"}, ""},
+		{"hello from the future", `hello|{"version":2,"name":"Senna"}`, nil, CodeVersion},
+		{"hello invalid", `hello|42`, nil, CodeInvalid},
+		{"input", `input|{"up":true,"steer":-0.5,"seq":7}`, Input{player.Input{Up: true, Steer: -0.5, Seq: 7}}, ""},
+		{"sense defaults", `sense|{"rays":3}`, Sense{sensor.Config{Rays: 3, Fov: sensor.Default.Fov, Range: sensor.Default.Range}}, ""},
+		{"sense invalid", `sense|{"rays":0}`, nil, CodeInvalid},
+		{"ack", `ack|12`, Ack{Seq: 12}, ""},
+		{"no prefix", `input`, nil, CodeMalformed},
+		{"unknown prefix", `honk|{}`, nil, CodeUnknown},
+		{"empty", ``, nil, CodeMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode([]byte(tt.message))
+			if tt.wantCode != "" {
+				e, ok := err.(*Error)
+				if !ok || e.Code != tt.wantCode {
+					t.Fatalf("got error %v, want code %q", err, tt.wantCode)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	messages := []Message{
+		Hello{Version: Version, Name: "Senna", Car: "grip"},
+		Input{player.Input{Left: true, Throttle: 0.5, Seq: 3}},
+		Sense{sensor.Default},
+		Ack{Seq: 9},
+	}
+
+	for _, m := range messages {
+		t.Run(m.Prefix(), func(t *testing.T) {
+			data, err := Encode(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, m) {
+				t.Errorf("got %+v, want %+v", got, m)
+			}
+		})
+	}
+}
@@ -2,12 +2,16 @@
 // the data to a format understandable by both client and server
 //
 // Every messages is a string structured as `<prefix>|<data>`
+// unless the client negotiated the binary subprotocol (see BinaryProtocol)
 package protocol
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -26,21 +30,59 @@ const (
 	CLOSEDOWN = "close"    // (server -> client) server counts down to zero before race will end
 	BESTLIST  = "best"     // (server -> client) server sends the ranking
 	REST      = "rest"     // (server -> client) server sends the countdown to the next game will start soon
-	INPUT     = "input"    // (client -> server) client sends what arrow-keys are pressed
+	SENSORS   = "sensors"  // (server -> client) server sends the sensor readings of the client's car (after SENSE)
+	DELTA     = "delta"    // (server -> client) server sends the changes of the game state since a snapshot the client acknowledged (instead of UPDATE)
+	ERROR     = "error"    // (server -> client) server tells why a message of the client could not be handled
+	SHUTDOWN  = "shutdown" // (server -> client) server is going away and closes the connection right after
+	INPUT     = "input"    // (client -> server) client sends what arrow-keys are pressed (or analog steer, throttle and brake)
 	HELLO     = "hello"    // (client -> server) client introduces himself and tells server his name
+	SENSE     = "sense"    // (client -> server) client asks to receive sensor readings configured by the payload
+	ACK       = "ack"      // (client -> server) client acknowledges the sequence number of the latest DELTA it applied
 )
 
+// hosts of the pages the game can be played from. Browsers connecting from pages of
+// other hosts are refused (clients that are not browsers do not send an origin and are accepted)
+var hosts = []string{"localhost:7999", "localhost:8080", "online.resamvi.io"}
+
+// AllowHosts sets the hosts of the pages the game can be played from.
+// It has to be called before connections are upgraded
+func AllowHosts(allowed []string) {
+	hosts = allowed
+}
+
+// checkOrigin reports whether the page that opened the websocket belongs to an allowed host
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	for _, h := range hosts {
+		if strings.EqualFold(u.Host, h) {
+			return true
+		}
+	}
+
+	return false
+}
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return r.Host == "localhost:7999" || r.Host == "online.resamvi.io"
-	},
+	Subprotocols:    []string{BinaryProtocol, JSONProtocol},
+	CheckOrigin:     checkOrigin,
 }
 
+// Conn is a websocket connection to a client
 type Conn struct {
-	wsCon *websocket.Conn
-	mu    sync.Mutex
+	wsCon  *websocket.Conn
+	mu     sync.Mutex
+	binary bool // whether the client negotiated the binary subprotocol
 }
 
 // Upgrade upgrades the HTTP server connection to the WebSocket protocol.
@@ -51,8 +93,17 @@ type Conn struct {
 // https://github.com/gorilla/websocket/issues/119)
 func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
 	wsCon, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{wsCon: wsCon, binary: wsCon.Subprotocol() == BinaryProtocol}, nil
+}
 
-	return &Conn{wsCon: wsCon}, err
+// Binary reports whether messages are sent as binary frames.
+// Payloads of updates then have to be encoded with EncodeUpdate and every other payload is JSON
+func (conn *Conn) Binary() bool {
+	return conn.binary
 }
 
 // Close closes the underlying network connection without sending or waiting for a close message.
@@ -63,6 +114,21 @@ func (conn *Conn) Close() error {
 	return conn.wsCon.Close()
 }
 
+// Shutdown starts the closing handshake by sending a close frame telling the client the server is going away.
+// Reads fail if the client does not answer within the grace period so the connection can be cleaned up
+func (conn *Conn) Shutdown(reason string, grace time.Duration) error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	err := conn.wsCon.WriteControl(websocket.CloseMessage, msg, time.Now().Add(grace))
+	if err != nil {
+		return err
+	}
+
+	return conn.wsCon.SetReadDeadline(time.Now().Add(grace))
+}
+
 // ReadMessage reads a message sent from the client
 func (conn *Conn) ReadMessage() (messageType int, p []byte, err error) {
 	return conn.wsCon.ReadMessage()
@@ -75,14 +141,16 @@ func (conn *Conn) WriteMessage(typ string, str []byte) error {
 	conn.mu.Lock()
 	defer conn.mu.Unlock()
 
+	if conn.binary {
+		c, ok := code(typ)
+		if !ok {
+			return fmt.Errorf("no binary code for message type %q", typ)
+		}
+
+		data := append([]byte{c}, str...)
+		return conn.wsCon.WriteMessage(websocket.BinaryMessage, data)
+	}
+
 	data := append([]byte(typ+"|"), str...)
 	return conn.wsCon.WriteMessage(websocket.TextMessage, data)
 }
-
-// Parse will extract the content of a message sent by the client
-// which complies with the protocol
-// TODO: We could convert json to the typed structs here
-func Parse(message []byte) (string, []byte) {
-	slice := strings.Split(string(message), "|")
-	return slice[0], []byte(slice[1])
-}
@@ -0,0 +1,35 @@
+package protocol
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{"no origin", "", true},
+		{"allowed page", "https://online.resamvi.io", true},
+		{"allowed page with port", "http://localhost:7999", true},
+		{"other page", "https://evil.example", false},
+		{"other port", "http://localhost:1234", false},
+		{"malformed", "://", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the request targets an allowed host no matter where the page is from
+			r := httptest.NewRequest("GET", "http://online.resamvi.io/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+
+			if got := checkOrigin(r); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
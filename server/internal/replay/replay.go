@@ -0,0 +1,170 @@
+// Package replay records races into compact files that can be played back later.
+//
+// A replay stores the inputs of every player per game cycle (only when they change)
+// together with the resulting states, so a race can either be re-simulated from
+// its inputs or simply be shown again frame by frame
+package replay
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"time"
+
+	"gitlab.com/resamvi/sennai/internal/player"
+	"gitlab.com/resamvi/sennai/internal/track"
+)
+
+// Version is the version of the replay format written by Save
+const Version = 5
+
+// MaxDuration is the longest race time that is recorded so races
+// nobody finishes do not keep growing their recording
+const MaxDuration = 30 * time.Minute
+
+// Replay is the recording of a single race
+type Replay struct {
+	Version int
+	Track   track.Track
+	Ghost   bool           // whether cars drove through each other
+	Walls   bool           // whether the track sides were solid walls
+	Tick    time.Duration  // simulated time of a frame
+	Names   map[int]string // names of the players by ID
+	Frames  []Frame        // one frame per game cycle in which players moved
+}
+
+// Frame is a single game cycle
+type Frame struct {
+	States []State   // state of every player at the start of the game cycle
+	Inputs []Command // inputs that changed since the previous frame
+	Cars   []Car     // car specs that changed since the previous frame
+}
+
+// State is the position of a player
+type State struct {
+	ID       int
+	X        float64
+	Y        float64
+	Rotation float64
+}
+
+// Command is the input of a player
+type Command struct {
+	ID    int
+	Input player.Input
+}
+
+// Car is the car spec of a player
+type Car struct {
+	ID   int
+	Spec player.CarSpec
+}
+
+// Recorder builds a replay from the captured game cycles
+type Recorder struct {
+	replay Replay
+	last   map[int]player.Input
+	specs  map[int]player.CarSpec
+}
+
+// NewRecorder starts recording a race on the given track
+func NewRecorder(t track.Track, ghost, walls bool, tick time.Duration) *Recorder {
+	return &Recorder{
+		replay: Replay{Version: Version, Track: t, Ghost: ghost, Walls: walls, Tick: tick, Names: make(map[int]string)},
+		last:   make(map[int]player.Input),
+		specs:  make(map[int]player.CarSpec),
+	}
+}
+
+// Capture records a game cycle with the players' states
+// before they are moved by the inputs they currently hold.
+// Nothing is recorded anymore once the recording is full
+func (r *Recorder) Capture(players []player.Player) {
+	if r.Full() {
+		return
+	}
+
+	frame := Frame{States: make([]State, 0, len(players))}
+
+	for _, p := range players {
+		frame.States = append(frame.States, State{ID: p.ID, X: p.X, Y: p.Y, Rotation: p.Rotation})
+		r.replay.Names[p.ID] = p.Name
+
+		// Sequence numbers change every frame but do not move the car
+		input := p.Input
+		input.Seq = 0
+
+		if last, ok := r.last[p.ID]; !ok || last != input {
+			frame.Inputs = append(frame.Inputs, Command{ID: p.ID, Input: input})
+			r.last[p.ID] = input
+		}
+
+		if spec, ok := r.specs[p.ID]; !ok || spec != p.Car {
+			frame.Cars = append(frame.Cars, Car{ID: p.ID, Spec: p.Car})
+			r.specs[p.ID] = p.Car
+		}
+	}
+
+	r.replay.Frames = append(r.replay.Frames, frame)
+}
+
+// Full reports whether MaxDuration of the race is recorded
+func (r *Recorder) Full() bool {
+	return time.Duration(len(r.replay.Frames))*r.replay.Tick >= MaxDuration
+}
+
+// Replay returns the recording so far
+func (r *Recorder) Replay() *Replay {
+	return &r.replay
+}
+
+// Save writes the replay gzip-compressed to a file
+func Save(path string, r *Replay) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+
+	err = gob.NewEncoder(zw).Encode(r)
+	if err != nil {
+		return err
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// Load reads a replay written by Save
+func Load(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var r Replay
+	err = gob.NewDecoder(zr).Decode(&r)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Version != Version {
+		return nil, fmt.Errorf("unsupported replay version %d", r.Version)
+	}
+
+	return &r, nil
+}
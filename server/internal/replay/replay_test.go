@@ -0,0 +1,46 @@
+package replay
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gitlab.com/resamvi/sennai/internal/player"
+	"gitlab.com/resamvi/sennai/internal/track"
+)
+
+func TestSaveLoad(t *testing.T) {
+	rec := NewRecorder(track.NewFromSeed(1), false, false, player.Step)
+	rec.Capture([]player.Player{{ID: 0, Name: "A", X: 1, Y: 2, Input: player.Input{Up: true, Seq: 1}}})
+	rec.Capture([]player.Player{{ID: 0, Name: "A", X: 3, Y: 4, Input: player.Input{Up: true, Seq: 2}}})
+
+	want := rec.Replay()
+	if len(want.Frames[1].Inputs) != 0 {
+		t.Errorf("unchanged input was recorded again")
+	}
+
+	path := filepath.Join(t.TempDir(), "race.replay")
+	if err := Save(path, want); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if !reflect.DeepEqual(got.Frames, want.Frames) || !reflect.DeepEqual(got.Names, want.Names) || got.Track.Seed != want.Track.Seed {
+		t.Errorf("replay changed after loading")
+	}
+}
+
+func TestMaxDuration(t *testing.T) {
+	rec := NewRecorder(track.NewFromSeed(1), false, false, MaxDuration/3)
+	for i := 0; i < 5; i++ {
+		rec.Capture([]player.Player{{ID: 0, Name: "A", X: float64(i)}})
+	}
+
+	if got := len(rec.Replay().Frames); got != 3 || !rec.Full() {
+		t.Errorf("got %d frames, want the recording to stop at 3", got)
+	}
+}
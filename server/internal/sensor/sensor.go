@@ -0,0 +1,134 @@
+// Package sensor computes what a driver can perceive of the track around its car.
+// The readings are meant to be fed as observations into AI drivers
+package sensor
+
+import (
+	"errors"
+
+	"gitlab.com/resamvi/sennai/internal/player"
+	"gitlab.com/resamvi/sennai/internal/track"
+	"gitlab.com/resamvi/sennai/pkg/math"
+)
+
+const maxrays = 64
+
+// Config determines what the sensors of a car can perceive
+type Config struct {
+	Rays  int     `json:"rays"`  // amount of rays fanned out in front of the car
+	Fov   float64 `json:"fov"`   // angle (in degrees) covered by the rays, centered on the heading
+	Range float64 `json:"range"` // distance after which a ray gives up
+}
+
+// Default is the sensor setup used if nothing else is configured
+var Default = Config{Rays: 9, Fov: 180, Range: 3000}
+
+// Validate checks if the sensors can be built as configured
+func (c Config) Validate() error {
+	if c.Rays < 1 || c.Rays > maxrays {
+		return errors.New("rays must be between 1 and 64")
+	}
+
+	if c.Fov < 0 || c.Fov > 360 {
+		return errors.New("fov must be between 0 and 360")
+	}
+
+	if c.Range <= 0 {
+		return errors.New("range must be positive")
+	}
+
+	return nil
+}
+
+// Reading is the observation of a single car at a single game cycle
+type Reading struct {
+	Rays         []float64 `json:"rays"`         // distance to the nearest track border per ray (Range if nothing is hit), from left to right
+	Offset       float64   `json:"offset"`       // signed distance to the center line (positive if right of it)
+	HeadingError float64   `json:"headingError"` // angle (in degrees) between heading and the next center line segment in the range of (-180, 180]
+	Speed        float64   `json:"speed"`        // distance moved per game cycle
+	Offroad      bool      `json:"offroad"`      // whether the car is off the track
+}
+
+// Layout is what the sensors measure of a track. It is prepared once per track
+// since building the segments of the borders costs more than casting the rays
+type Layout struct {
+	walls  []math.Segment // both track sides
+	center []math.Segment
+}
+
+// NewLayout prepares the track for taking measurements
+func NewLayout(t track.Track) Layout {
+	return Layout{walls: t.Walls(), center: t.Center.Segments()}
+}
+
+// Read takes the measurements for player p on the track of the layout
+func Read(p player.Player, l Layout, cfg Config) Reading {
+	pos := math.Point{X: p.X, Y: p.Y}
+
+	reading := Reading{
+		Rays:    make([]float64, cfg.Rays),
+		Speed:   p.Speed(),
+		Offroad: p.Offroad(),
+	}
+
+	dirs := make([]math.Vector, cfg.Rays)
+	for i := range dirs {
+		angle := p.Rotation
+		if cfg.Rays > 1 {
+			angle += -cfg.Fov/2 + float64(i)*cfg.Fov/float64(cfg.Rays-1)
+		}
+
+		dirs[i] = math.Vector{X: 1, Y: 0}
+		dirs[i].Rotate(angle)
+		reading.Rays[i] = cfg.Range
+	}
+
+	// Every ray is cast against the walls within range
+	for _, w := range l.walls {
+		if !reaches(pos, w, cfg.Range) {
+			continue
+		}
+
+		for i, dir := range dirs {
+			if d, ok := w.Cast(pos, dir); ok && d < reading.Rays[i] {
+				reading.Rays[i] = d
+			}
+		}
+	}
+
+	if next, ok := nearest(pos, l.center); ok {
+		reading.Offset = next.Side(pos)
+		reading.HeadingError = math.NormalizeAngle(math.VectorFromTo(next.A, next.B).Angle() - p.Rotation)
+	}
+
+	return reading
+}
+
+// reaches reports whether the wall may come within distance of the origin
+// (i.e. it does not lie completely on one side of the square around the origin)
+func reaches(origin math.Point, w math.Segment, distance float64) bool {
+	switch {
+	case w.A.X < origin.X-distance && w.B.X < origin.X-distance:
+		return false
+	case w.A.X > origin.X+distance && w.B.X > origin.X+distance:
+		return false
+	case w.A.Y < origin.Y-distance && w.B.Y < origin.Y-distance:
+		return false
+	case w.A.Y > origin.Y+distance && w.B.Y > origin.Y+distance:
+		return false
+	}
+
+	return true
+}
+
+// nearest returns the segment closest to p
+func nearest(p math.Point, segments []math.Segment) (math.Segment, bool) {
+	best, found, min := math.Segment{}, false, 0.0
+	for _, s := range segments {
+		d := p.DistanceTo(s.Closest(p))
+		if !found || d < min {
+			best, found, min = s, true, d
+		}
+	}
+
+	return best, found
+}
@@ -0,0 +1,45 @@
+package sensor
+
+import (
+	"testing"
+
+	"gitlab.com/resamvi/sennai/internal/player"
+	"gitlab.com/resamvi/sennai/internal/track"
+	"gitlab.com/resamvi/sennai/pkg/math"
+)
+
+func TestRead(t *testing.T) {
+	straight := track.Track{
+		Center: track.Outline{math.Point{X: 0, Y: 0}, math.Point{X: 1000, Y: 0}, math.Point{X: 2000, Y: 0}},
+		Inner:  track.Outline{math.Point{X: 0, Y: -400}, math.Point{X: 2000, Y: -400}},
+		Outer:  track.Outline{math.Point{X: 0, Y: 400}, math.Point{X: 2000, Y: 400}},
+	}
+
+	p := player.Player{X: 500, Y: 100, Rotation: 10}
+	got := Read(p, NewLayout(straight), Config{Rays: 3, Fov: 180, Range: 3000})
+
+	want := []float64{500 / math.Cos(10), 3000, 300 / math.Cos(10)}
+	for i := range want {
+		if d := got.Rays[i] - want[i]; d > 1e-6 || d < -1e-6 {
+			t.Errorf("ray %d: got %v, want %v", i, got.Rays[i], want[i])
+		}
+	}
+
+	if got.Offset != 100 {
+		t.Errorf("offset: got %v, want 100", got.Offset)
+	}
+
+	if got.HeadingError != -10 {
+		t.Errorf("heading error: got %v, want -10", got.HeadingError)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Default.Validate(); err != nil {
+		t.Errorf("default config is invalid: %v", err)
+	}
+
+	if err := (Config{Rays: 0, Fov: 90, Range: 100}).Validate(); err == nil {
+		t.Errorf("config without rays is valid")
+	}
+}
@@ -0,0 +1,123 @@
+// Package sim is a gym-style training environment for AI drivers.
+//
+// It wraps a headless game that is advanced one game cycle per call to Step
+// instead of by a clock and skips every countdown, so episodes run as fast as the CPU allows
+package sim
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/resamvi/sennai/internal/game"
+	"gitlab.com/resamvi/sennai/internal/player"
+	"gitlab.com/resamvi/sennai/internal/sensor"
+	"gitlab.com/resamvi/sennai/internal/track"
+)
+
+// Config describes the environment
+type Config struct {
+	Agents   int           // amount of cars controlled by the actions passed to Step
+	MaxSteps int           // episode is cut off after this many steps (0 = never)
+	Sensors  sensor.Config // what the agents observe
+	Track    track.GeneratorConfig
+	Laps     int           // laps to complete an episode (defaults to 1)
+	Ghost    bool          // agents drive through each other instead of colliding
+	Walls    bool          // track sides are solid walls instead of sand
+	Tick     time.Duration // simulated time of a step (defaults to 30ms)
+}
+
+// DefaultConfig is a single agent with default sensors on default tracks and an episode length of 90s of race time
+var DefaultConfig = Config{Agents: 1, MaxSteps: 3000, Sensors: sensor.Default, Track: track.Default}
+
+// Observation contains the sensor readings of every agent (in order of the agents)
+type Observation []sensor.Reading
+
+// Info holds diagnostic data of the episode that is not part of the observation
+type Info struct {
+	Steps    int       // steps taken in this episode
+	Progress []float64 // progress of every agent in the range of 0 and 100
+	Finished []bool    // whether an agent has crossed the finish line
+}
+
+// Env is a training environment. It is not safe for concurrent use;
+// run multiple environments to train in parallel
+type Env struct {
+	cfg    Config
+	game   *game.Game
+	layout sensor.Layout // of the episode's track
+	agents []int         // playerIDs of the agents
+	last   []float64     // progress of every agent after the previous step
+	steps  int
+}
+
+// New creates an environment. Reset has to be called before the first Step
+func New(cfg Config) *Env {
+	return &Env{cfg: cfg}
+}
+
+// Reset starts a new episode on the track generated by the seed
+// and returns the initial observation
+func (e *Env) Reset(seed int64) Observation {
+	e.game = game.NewHeadless(track.NewFromConfig(e.cfg.Track, seed), game.Settings{Laps: e.cfg.Laps, Ghost: e.cfg.Ghost, Walls: e.cfg.Walls, Tick: e.cfg.Tick})
+	e.layout = e.game.Layout()
+	e.agents = make([]int, e.cfg.Agents)
+	e.last = make([]float64, e.cfg.Agents)
+	e.steps = 0
+
+	for i := range e.agents {
+		e.agents[i] = e.game.Join(fmt.Sprintf("Agent %d", i))
+	}
+
+	return e.observe()
+}
+
+// Step applies one action per agent, advances the game by exactly one game cycle and returns
+// the new observation, the reward of every agent and whether the episode is over.
+// The reward of an agent is the progress (in percentage points) it made during the step
+func (e *Env) Step(actions []player.Input) (Observation, []float64, bool, Info) {
+	for i, id := range e.agents {
+		if i < len(actions) {
+			e.game.SetPlayerInput(actions[i], id)
+		}
+	}
+
+	e.game.Update()
+	e.steps++
+
+	info := Info{
+		Steps:    e.steps,
+		Progress: make([]float64, len(e.agents)),
+		Finished: make([]bool, len(e.agents)),
+	}
+
+	rewards := make([]float64, len(e.agents))
+	for i, id := range e.agents {
+		p, _ := e.game.Player(id)
+
+		rewards[i] = p.Progress - e.last[i]
+		e.last[i] = p.Progress
+
+		info.Progress[i] = p.Progress
+		info.Finished[i] = p.Timing.Finished
+	}
+
+	done := e.game.Phase() == game.FINISHED || (e.cfg.MaxSteps > 0 && e.steps >= e.cfg.MaxSteps)
+
+	return e.observe(), rewards, done, info
+}
+
+// Track returns the layout of the current episode
+func (e *Env) Track() track.Track {
+	return e.game.Track()
+}
+
+// observe takes the sensor readings of every agent
+func (e *Env) observe() Observation {
+	obs := make(Observation, len(e.agents))
+	for i, id := range e.agents {
+		p, _ := e.game.Player(id)
+		obs[i] = sensor.Read(p, e.layout, e.cfg.Sensors)
+	}
+
+	return obs
+}
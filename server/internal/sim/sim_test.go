@@ -0,0 +1,63 @@
+package sim
+
+import (
+	"reflect"
+	"testing"
+
+	"gitlab.com/resamvi/sennai/internal/player"
+)
+
+func TestDeterministic(t *testing.T) {
+	run := func() (Observation, []float64) {
+		env := New(DefaultConfig)
+		env.Reset(42)
+
+		var obs Observation
+		var rewards []float64
+		for i := 0; i < 200; i++ {
+			obs, rewards, _, _ = env.Step([]player.Input{{Up: true, Left: i%50 < 10}})
+		}
+
+		return obs, rewards
+	}
+
+	obs1, rewards1 := run()
+	obs2, rewards2 := run()
+
+	if !reflect.DeepEqual(obs1, obs2) || !reflect.DeepEqual(rewards1, rewards2) {
+		t.Errorf("same seed and actions produced different episodes")
+	}
+}
+
+func TestMaxSteps(t *testing.T) {
+	env := New(Config{Agents: 2, MaxSteps: 10, Sensors: DefaultConfig.Sensors, Track: DefaultConfig.Track})
+	obs := env.Reset(1)
+
+	if len(obs) != 2 {
+		t.Fatalf("got %d observations, want 2", len(obs))
+	}
+
+	for i := 1; i <= 10; i++ {
+		_, _, done, info := env.Step(nil)
+
+		if info.Steps != i {
+			t.Errorf("got %d steps, want %d", info.Steps, i)
+		}
+
+		if done != (i == 10) {
+			t.Errorf("step %d: got done %v", i, done)
+		}
+	}
+}
+
+func BenchmarkStep(b *testing.B) {
+	env := New(DefaultConfig)
+	env.Reset(1)
+
+	actions := []player.Input{{Up: true}}
+	for i := 0; i < b.N; i++ {
+		if _, _, done, _ := env.Step(actions); done {
+			env.Reset(int64(i))
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package timing measures laps and sectors of a race.
+//
+// A course consists of gates placed across the track: the start/finish line
+// followed by evenly spaced checkpoints. A gate counts as passed when the movement
+// of a car during a game cycle intersects it in racing direction and
+// gates have to be passed in order
+package timing
+
+import (
+	"time"
+
+	"gitlab.com/resamvi/sennai/internal/track"
+	"gitlab.com/resamvi/sennai/pkg/math"
+)
+
+// gatespan is how far gates reach beyond the center line in multiples of the track width.
+// Gates are wider than the track so running wide through the sand does not miss a checkpoint
+const gatespan = 2.0
+
+// Gate is a line across the track
+type Gate struct {
+	Line    math.Segment `json:"line"`
+	Forward math.Vector  `json:"forward"` // racing direction
+	index   int          // index of the track's center line the gate is placed at
+}
+
+// Course contains the gates of a track and the amount of laps to race
+type Course struct {
+	Gates  []Gate `json:"gates"` // start/finish line followed by the checkpoints
+	Laps   int    `json:"laps"`
+	center track.Outline
+}
+
+// Timer is the timing of a single car. The zero value is a car at the start of the race
+type Timer struct {
+	Lap        int             `json:"lap"`        // completed laps
+	Sector     int             `json:"sector"`     // current sector (the n-th sector ends at the n+1-th gate)
+	Splits     []time.Duration `json:"splits"`     // sector times of the current lap
+	LastSplits []time.Duration `json:"lastSplits"` // sector times of the previous lap
+	BestSplits []time.Duration `json:"bestSplits"` // fastest time of every sector so far
+	LastLap    time.Duration   `json:"lastLap"`    // time of the previous lap
+	BestLap    time.Duration   `json:"bestLap"`    // time of the fastest lap so far
+	Finished   bool            `json:"finished"`   // whether every lap is completed
+
+	sectorStart time.Duration
+	lapStart    time.Duration
+}
+
+// NewCourse places the start/finish line and `checkpoints` gates (atleast one) on the track
+func NewCourse(t track.Track, checkpoints int, laps int) Course {
+	if checkpoints < 1 {
+		checkpoints = 1
+	}
+
+	n := len(t.Center)
+	if n > 1 && t.Center[0] == t.Center[n-1] {
+		n-- // last point repeats the first one
+	}
+
+	start := nearest(t.Center[:n], math.Interpolate(t.Finish.A, t.Finish.B, 0.5))
+
+	c := Course{Laps: laps, center: t.Center[:n]}
+
+	half := math.VectorFromTo(t.Finish.A, t.Finish.B)
+	half.Scale(gatespan / 2)
+
+	mid := math.Interpolate(t.Finish.A, t.Finish.B, 0.5)
+	a, b := mid, mid
+	a.MoveBy(half.Opposite())
+	b.MoveBy(half)
+
+	c.Gates = append(c.Gates, Gate{Line: math.Segment{A: a, B: b}, Forward: c.forward(start), index: start})
+
+	for k := 1; k <= checkpoints; k++ {
+		i := (start + k*n/(checkpoints+1)) % n
+
+		across := c.forward(i)
+		across.Rotate(90)
+		across.Scale(gatespan * t.Width)
+
+		a, b := c.center[i], c.center[i]
+		a.MoveBy(across)
+		b.MoveBy(across.Opposite())
+
+		c.Gates = append(c.Gates, Gate{Line: math.Segment{A: a, B: b}, Forward: c.forward(i), index: i})
+	}
+
+	return c
+}
+
+// Cross checks if the car passed the next gate by moving from `from` to `to`
+// and updates the timer accordingly. `now` is the elapsed race time
+func (c Course) Cross(t *Timer, from, to math.Point, now time.Duration) {
+	if t.Finished || len(c.Gates) == 0 {
+		return
+	}
+
+	gate := c.Gates[(t.Sector+1)%len(c.Gates)]
+
+	move := math.Segment{A: from, B: to}
+	if _, ok := gate.Line.Intersect(move); !ok || math.VectorFromTo(from, to).Dot(gate.Forward) <= 0 {
+		return
+	}
+
+	t.Splits = append(t.Splits, now-t.sectorStart)
+	t.sectorStart = now
+	t.Sector++
+
+	if t.Sector < len(c.Gates) {
+		return
+	}
+
+	// Crossed the finish line
+	lap := now - t.lapStart
+	t.LastLap = lap
+	if t.BestLap == 0 || lap < t.BestLap {
+		t.BestLap = lap
+	}
+
+	if t.BestSplits == nil {
+		t.BestSplits = append([]time.Duration(nil), t.Splits...)
+	}
+	for i, split := range t.Splits {
+		if split < t.BestSplits[i] {
+			t.BestSplits[i] = split
+		}
+	}
+
+	t.Lap++
+	t.Sector = 0
+	t.LastSplits = t.Splits
+	t.Splits = nil
+	t.lapStart = now
+	t.Finished = t.Lap >= c.Laps
+}
+
+// Progress returns how much of the race the car at `pos` has completed in the range of 0 and 100
+func (c Course) Progress(t Timer, pos math.Point) float64 {
+	if t.Finished {
+		return 100
+	}
+
+	if len(c.Gates) == 0 || c.Laps == 0 {
+		return 0
+	}
+
+	// How far the car made it into the current sector
+	from := c.Gates[t.Sector].index
+	to := c.Gates[(t.Sector+1)%len(c.Gates)].index
+
+	length := c.distance(from, to)
+	covered := c.distance(from, nearest(c.center, pos))
+
+	fraction := 0.0
+	if covered < length {
+		fraction = float64(covered) / float64(length)
+	}
+
+	sectors := float64(t.Lap*len(c.Gates)+t.Sector) + fraction
+	return math.Floor(sectors / float64(c.Laps*len(c.Gates)) * 100)
+}
+
+// distance returns the amount of center line points from index i forward to index j
+func (c Course) distance(i, j int) int {
+	return (j - i + len(c.center)) % len(c.center)
+}
+
+// forward returns the racing direction at index i of the center line
+func (c Course) forward(i int) math.Vector {
+	v := math.VectorFromTo(c.center[i], c.center[(i+1)%len(c.center)])
+	v.Normalize()
+	return v
+}
+
+// nearest returns the index of the point of the outline closest to p
+func nearest(ol track.Outline, p math.Point) int {
+	best := 0
+	for i := range ol {
+		if p.DistanceTo(ol[i]) < p.DistanceTo(ol[best]) {
+			best = i
+		}
+	}
+
+	return best
+}
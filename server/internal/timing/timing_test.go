@@ -0,0 +1,137 @@
+package timing
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/resamvi/sennai/internal/track"
+	"gitlab.com/resamvi/sennai/pkg/math"
+)
+
+func square(t *testing.T) track.Track {
+	f := track.File{
+		Version: track.Version,
+		Width:   100,
+		Center:  track.Outline{{X: 0, Y: 0}, {X: 2000, Y: 0}, {X: 2000, Y: 2000}, {X: 0, Y: 2000}},
+	}
+
+	trk, err := f.Track()
+	if err != nil {
+		t.Fatalf("building track: %v", err)
+	}
+
+	return trk
+}
+
+// drive moves a car from its position through every point of the closed center line,
+// beginning and ending at the point with index `start`
+func drive(c Course, timer *Timer, from math.Point, center track.Outline, start int, now *time.Duration) math.Point {
+	n := len(center) - 1 // last point repeats the first one
+
+	for k := 0; k <= n; k++ {
+		to := center[(start+k)%n]
+
+		*now += time.Second
+		c.Cross(timer, from, to, *now)
+		from = to
+	}
+
+	return from
+}
+
+func TestLaps(t *testing.T) {
+	trk := square(t)
+	c := NewCourse(trk, 3, 2)
+
+	if len(c.Gates) != 4 {
+		t.Fatalf("got %d gates, want 4", len(c.Gates))
+	}
+
+	var timer Timer
+	var now time.Duration
+
+	start := c.Gates[0].index
+
+	pos := drive(c, &timer, trk.Grid[0].Position, trk.Center, start, &now)
+	if timer.Lap != 1 || timer.Finished || timer.BestLap == 0 {
+		t.Errorf("after one lap: got %+v", timer)
+	}
+
+	first := timer.LastSplits
+	if len(first) != 4 || len(timer.Splits) != 0 {
+		t.Fatalf("after one lap: got splits %v of the last lap and %v of the current one", first, timer.Splits)
+	}
+
+	if sum(first) != timer.LastLap || !equal(timer.BestSplits, first) {
+		t.Errorf("after one lap: got splits %v and best splits %v adding up to %v, want %v", first, timer.BestSplits, sum(first), timer.LastLap)
+	}
+
+	if p := c.Progress(timer, pos); p < 50 || p >= 100 {
+		t.Errorf("after one lap: got progress %v", p)
+	}
+
+	drive(c, &timer, pos, trk.Center, start, &now)
+	if timer.Lap != 2 || !timer.Finished {
+		t.Errorf("after two laps: got %+v", timer)
+	}
+
+	if len(timer.LastSplits) != 4 || sum(timer.LastSplits) != timer.LastLap {
+		t.Errorf("after two laps: got splits %v, want them to add up to %v", timer.LastSplits, timer.LastLap)
+	}
+
+	for i := range timer.BestSplits {
+		best := first[i]
+		if timer.LastSplits[i] < best {
+			best = timer.LastSplits[i]
+		}
+
+		if timer.BestSplits[i] != best {
+			t.Errorf("got best split %v of sector %d, want %v", timer.BestSplits[i], i, best)
+		}
+	}
+
+	if p := c.Progress(timer, pos); p != 100 {
+		t.Errorf("after two laps: got progress %v, want 100", p)
+	}
+}
+
+func TestWrongWay(t *testing.T) {
+	trk := square(t)
+	c := NewCourse(trk, 3, 1)
+
+	var timer Timer
+	var now time.Duration
+
+	reversed := make(track.Outline, 0, len(trk.Center))
+	for i := len(trk.Center) - 1; i >= 0; i-- {
+		reversed = append(reversed, trk.Center[i])
+	}
+
+	drive(c, &timer, reversed[0], reversed, 0, &now)
+	if timer.Lap != 0 || timer.Sector != 0 {
+		t.Errorf("driving the wrong way counted: got %+v", timer)
+	}
+}
+
+func sum(splits []time.Duration) time.Duration {
+	var total time.Duration
+	for _, s := range splits {
+		total += s
+	}
+
+	return total
+}
+
+func equal(a, b []time.Duration) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,211 @@
+package track
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gitlab.com/resamvi/sennai/pkg/math"
+)
+
+// Version is the version of the track file format written by Save
+const Version = 1
+
+// File is the on-disk representation of a hand-authored track.
+// Borders are derived from the center line and width when loading.
+// Finish and Grid are optional. A missing finish line is placed at the start of the center line
+// and a missing grid behind the finish line
+type File struct {
+	Version int           `json:"version"`
+	Name    string        `json:"name"`
+	Width   float64       `json:"width"`
+	Center  Outline       `json:"center"`
+	Finish  *math.Segment `json:"finish,omitempty"`
+	Grid    []Slot        `json:"grid,omitempty"`
+}
+
+// ErrSelfIntersecting is returned for tracks whose center line crosses itself
+var ErrSelfIntersecting = errors.New("center line intersects itself")
+
+// Load reads a track from a file. Files ending in .svg are imported
+// from the first path element, every other file is expected to be in the JSON format of File
+func Load(path string) (Track, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Track{}, err
+	}
+
+	var f File
+	if strings.EqualFold(filepath.Ext(path), ".svg") {
+		f, err = ImportSVG(data)
+	} else {
+		err = json.Unmarshal(data, &f)
+	}
+
+	if err != nil {
+		return Track{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if f.Name == "" {
+		f.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	t, err := f.Track()
+	if err != nil {
+		return Track{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return t, nil
+}
+
+// Save writes the track to a file in the JSON format of File
+func Save(path string, t Track) error {
+	finish := t.Finish
+
+	f := File{
+		Version: Version,
+		Name:    t.Name,
+		Width:   t.Width,
+		Center:  t.Center,
+		Finish:  &finish,
+		Grid:    t.Grid,
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// LoadDir loads every track file (.json and .svg) of a directory sorted by file name
+func LoadDir(dir string) ([]Track, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file.Name()))
+		if !file.IsDir() && (ext == ".json" || ext == ".svg") {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+
+	tracks := make([]Track, 0, len(names))
+	for _, name := range names {
+		t, err := Load(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		tracks = append(tracks, t)
+	}
+
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("%s: no track files found", dir)
+	}
+
+	return tracks, nil
+}
+
+// Track validates the file and builds the track it describes
+func (f File) Track() (Track, error) {
+	if f.Version != Version {
+		return Track{}, fmt.Errorf("unsupported version %d", f.Version)
+	}
+
+	if f.Width <= 0 {
+		return Track{}, errors.New("width must be positive")
+	}
+
+	center := append(Outline{}, f.Center...)
+	if len(center) < 3 {
+		return Track{}, errors.New("center line needs atleast 3 points")
+	}
+
+	// Tracks are circuits
+	if center[0] != center[len(center)-1] {
+		center.Push(center[0])
+	}
+
+	if center.Intersects() {
+		return Track{}, ErrSelfIntersecting
+	}
+
+	// Dense center lines are needed to determine whether a player is offroad
+	t := Track{Name: f.Name, Width: f.Width, Center: center.Resample(f.Width / 2)}
+	t.build()
+
+	// The grid is placed behind a custom finish line unless it is given as well
+	if f.Finish != nil {
+		t.Finish = *f.Finish
+		t.placeGrid(t.Center.nearest(math.Interpolate(t.Finish.A, t.Finish.B, 0.5)))
+	}
+
+	if len(f.Grid) > 0 {
+		t.Grid = f.Grid
+	}
+
+	return t, nil
+}
+
+// nearest returns the index of the point of the outline closest to p
+func (ol Outline) nearest(p math.Point) int {
+	best := 0
+	for i := range ol {
+		if p.DistanceTo(ol[i]) < p.DistanceTo(ol[best]) {
+			best = i
+		}
+	}
+
+	return best
+}
+
+// Intersects reports whether any two segments of the outline that are not neighbours cross
+func (ol Outline) Intersects() bool {
+	segments := ol.Segments()
+	closed := len(ol) > 1 && ol[0] == ol[len(ol)-1]
+
+	for i := 0; i < len(segments); i++ {
+		for j := i + 2; j < len(segments); j++ {
+
+			// first and last segment share a point in closed outlines
+			if closed && i == 0 && j == len(segments)-1 {
+				continue
+			}
+
+			if _, ok := segments[i].Intersect(segments[j]); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Resample returns the outline with points inserted so that
+// consecutive points are atmost `spacing` apart
+func (ol Outline) Resample(spacing float64) Outline {
+	if len(ol) == 0 {
+		return Outline{}
+	}
+
+	modified := Outline{ol[0]}
+	for _, s := range ol.Segments() {
+		steps := int(math.Ceil(s.A.DistanceTo(s.B) / spacing))
+
+		for k := 1; k <= steps; k++ {
+			modified.Push(math.Interpolate(s.A, s.B, float64(k)/float64(steps)))
+		}
+	}
+
+	return modified
+}
@@ -0,0 +1,129 @@
+package track
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/resamvi/sennai/pkg/math"
+)
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "square.json")
+
+	f := File{
+		Version: Version,
+		Name:    "square",
+		Width:   100,
+		Center:  Outline{{X: 0, Y: 0}, {X: 2000, Y: 0}, {X: 2000, Y: 2000}, {X: 0, Y: 2000}},
+	}
+
+	want, err := f.Track()
+	if err != nil {
+		t.Fatalf("building track: %v", err)
+	}
+
+	if err := Save(path, want); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if got.Name != want.Name || got.Width != want.Width || got.Finish != want.Finish || len(got.Grid) != len(want.Grid) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if !got.Center.Equal(want.Center) {
+		t.Errorf("center line changed after loading")
+	}
+}
+
+func TestFileTrack(t *testing.T) {
+	var tests = []struct {
+		name  string
+		file  File
+		valid bool
+	}{
+		{
+			"Triangle",
+			File{Version: Version, Width: 100, Center: Outline{{X: 0, Y: 0}, {X: 1000, Y: 0}, {X: 0, Y: 1000}}},
+			true,
+		},
+		{
+			"Figure eight",
+			File{Version: Version, Width: 100, Center: Outline{{X: 0, Y: 0}, {X: 1000, Y: 1000}, {X: 1000, Y: 0}, {X: 0, Y: 1000}}},
+			false,
+		},
+		{
+			"Unknown version",
+			File{Version: Version + 1, Width: 100, Center: Outline{{X: 0, Y: 0}, {X: 1000, Y: 0}, {X: 0, Y: 1000}}},
+			false,
+		},
+		{
+			"Too few points",
+			File{Version: Version, Width: 100, Center: Outline{{X: 0, Y: 0}, {X: 1000, Y: 0}}},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.file.Track()
+			if (err == nil) != tt.valid {
+				t.Errorf("got %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCustomFinish(t *testing.T) {
+	f := File{
+		Version: Version,
+		Width:   100,
+		Center:  Outline{{X: 0, Y: 0}, {X: 2000, Y: 0}, {X: 2000, Y: 2000}, {X: 0, Y: 2000}},
+		Finish:  &math.Segment{A: math.Point{X: 1000, Y: -100}, B: math.Point{X: 1000, Y: 100}},
+	}
+
+	trk, err := f.Track()
+	if err != nil {
+		t.Fatalf("building track: %v", err)
+	}
+
+	// cars line up right behind the finish line in racing direction (+x)
+	for i, slot := range trk.Grid {
+		if slot.Position.X >= 1000 || slot.Position.X < 1000-gridsize*gridspacing {
+			t.Errorf("got slot %d at %v, want it right behind the finish line", i, slot.Position)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	got, err := ParsePath("M10-20 l 5e1,0 V10h-50z")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	want := Outline{{X: 10, Y: -20}, {X: 60, Y: -20}, {X: 60, Y: 10}, {X: 10, Y: 10}, {X: 10, Y: -20}}
+	if !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := ParsePath("M0 0 C 1 1 2 2 3 3"); err == nil {
+		t.Errorf("curves should not be supported")
+	}
+}
+
+func TestImportSVG(t *testing.T) {
+	svg := `<svg xmlns="http://www.w3.org/2000/svg"><g><path id="loop" stroke-width="200" d="M0 0 H1000 V1000 H0 Z"/></g></svg>`
+
+	f, err := ImportSVG([]byte(svg))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	if f.Name != "loop" || f.Width != 100 || len(f.Center) != 5 || f.Center[2] != (math.Point{X: 1000, Y: 1000}) {
+		t.Errorf("got %v", f)
+	}
+}
@@ -0,0 +1,221 @@
+package track
+
+import (
+	"errors"
+	"math/rand"
+
+	"gitlab.com/resamvi/sennai/pkg/math"
+)
+
+// GeneratorConfig determines the shape of generated tracks
+type GeneratorConfig struct {
+	Points     int `json:"points"`     // amount of random points the track is formed around (has to be >=3)
+	Iterations int `json:"iterations"` // how often the points are spaced apart
+
+	MaxWidth    float64 `json:"maxWidth"`    // width of the area the points are scattered in
+	MaxHeight   float64 `json:"maxHeight"`   // height of the area the points are scattered in
+	MinDistance float64 `json:"minDistance"` // distance the points are spaced apart by
+
+	Difficulty      float64 `json:"difficulty"`      // the higher the less likely a corner is sharpened
+	MaxDisplacement float64 `json:"maxDisplacement"` // how far a corner may be displaced when sharpening
+
+	// Width is the width of center <-> border (i.e. total track width is 2*Width)
+	// and determines the radius of the offroad circle.
+	// An offroad circle is a circle that is centered on the player and as soon as
+	// no point of the track is inside the circle anymore the player is considered "offroad"
+	Width float64 `json:"width"`
+}
+
+var (
+	// Default is a balanced, mid-sized circuit
+	Default = GeneratorConfig{
+		Points:          40,
+		Iterations:      3,
+		MaxWidth:        8000,
+		MaxHeight:       6000,
+		MinDistance:     1500,
+		Difficulty:      5,
+		MaxDisplacement: 800,
+		Width:           400,
+	}
+
+	// Sprint is a short circuit that is completed quickly
+	Sprint = GeneratorConfig{
+		Points:          20,
+		Iterations:      3,
+		MaxWidth:        5000,
+		MaxHeight:       3500,
+		MinDistance:     1200,
+		Difficulty:      5,
+		MaxDisplacement: 600,
+		Width:           400,
+	}
+
+	// Technical is a narrow circuit with many sharp corners
+	Technical = GeneratorConfig{
+		Points:          60,
+		Iterations:      2,
+		MaxWidth:        8000,
+		MaxHeight:       6000,
+		MinDistance:     1000,
+		Difficulty:      2,
+		MaxDisplacement: 1200,
+		Width:           300,
+	}
+
+	// Oval is a wide circuit with long straights and no sharpened corners
+	Oval = GeneratorConfig{
+		Points:          12,
+		Iterations:      3,
+		MaxWidth:        10000,
+		MaxHeight:       5000,
+		MinDistance:     2500,
+		Difficulty:      10,
+		MaxDisplacement: 0,
+		Width:           500,
+	}
+
+	// Presets are the generator configs selectable by name
+	Presets = map[string]GeneratorConfig{
+		"default":   Default,
+		"sprint":    Sprint,
+		"technical": Technical,
+		"oval":      Oval,
+	}
+)
+
+// Validate checks if tracks can be generated with the config
+func (cfg GeneratorConfig) Validate() error {
+	if cfg.Points < 3 {
+		return errors.New("points must be atleast 3")
+	}
+
+	if cfg.Iterations < 0 {
+		return errors.New("iterations must not be negative")
+	}
+
+	if cfg.MaxWidth <= 0 || cfg.MaxHeight <= 0 {
+		return errors.New("maxWidth and maxHeight must be positive")
+	}
+
+	if cfg.MinDistance < 0 || cfg.MaxDisplacement < 0 || cfg.Difficulty < 0 {
+		return errors.New("minDistance, maxDisplacement and difficulty must not be negative")
+	}
+
+	if cfg.Width <= 0 {
+		return errors.New("width must be positive")
+	}
+
+	return nil
+}
+
+// NewFromConfig creates the track belonging to the seed shaped by the config.
+// The same config and seed always result in the same track
+func NewFromConfig(cfg GeneratorConfig, seed int64) Track {
+	rng := rand.New(rand.NewSource(seed))
+
+	outline := Outline{}
+	for i := 0; i < cfg.Points; i++ {
+		p := math.Point{X: rng.Float64() * cfg.MaxWidth, Y: rng.Float64() * cfg.MaxHeight}
+		outline.Push(p)
+	}
+
+	track := outline.Hull()
+	for i := 0; i < cfg.Iterations; i++ {
+		track = track.SpaceApart(cfg.MinDistance)
+	}
+
+	track = track.
+		SharpenCorners(rng, cfg.Difficulty, cfg.MaxDisplacement).
+		Smoothen()
+
+	t := Track{Preset: preset(cfg), Seed: seed, Width: cfg.Width, Center: track}
+	t.build()
+
+	return t
+}
+
+// preset returns the name of the preset of a config (empty for custom configs)
+func preset(cfg GeneratorConfig) string {
+	for name, c := range Presets {
+		if c == cfg {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// build derives the borders, the start/finish line and the grid from the center line
+func (t *Track) build() {
+	t.Inner, t.Outer = borders(t.Center, t.Width)
+
+	start := startindex % (len(t.Center) - 1)
+	from, to := t.Center[start], t.Center[start+1]
+
+	across := math.VectorFromTo(from, to)
+	across.Normalize()
+	across.Rotate(90)
+	across.Scale(t.Width)
+
+	a, b := from, from
+	a.MoveBy(across)
+	b.MoveBy(across.Opposite())
+	t.Finish = math.Segment{A: a, B: b}
+
+	t.placeGrid(start)
+}
+
+// placeGrid lines up the starting positions behind index `start` of the center line
+func (t *Track) placeGrid(start int) {
+	t.Grid = make([]Slot, gridsize)
+	for i := range t.Grid {
+		pos, heading := t.Center.behind(start, float64(i/2+1)*gridspacing)
+
+		side := math.Vector{X: 1, Y: 0}
+		side.Rotate(heading + 90)
+		side.Scale(t.Width / 3)
+		if i%2 == 1 {
+			side = side.Opposite()
+		}
+		pos.MoveBy(side)
+
+		t.Grid[i] = Slot{Position: pos, Rotation: heading}
+	}
+}
+
+// borders returns the inner and outer border of a center line
+// with points removed that come too close to the center line
+func borders(center Outline, width float64) (Outline, Outline) {
+	inner, outer := center.Inner(width), center.Outer(width)
+
+	// Remove interfering points
+	for _, p1 := range center {
+
+		for k := 0; k < len(inner); k++ {
+			p2 := inner[k]
+
+			if p1 == p2 {
+				continue
+			}
+
+			if p1.DistanceTo(p2)+2 < width {
+				inner.Remove(k)
+			}
+		}
+
+		for k := 0; k < len(outer); k++ {
+			p2 := outer[k]
+
+			if p1 == p2 {
+				continue
+			}
+
+			if p1.DistanceTo(p2)+2 < width {
+				outer.Remove(k)
+			}
+		}
+	}
+
+	return inner, outer
+}
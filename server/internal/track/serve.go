@@ -0,0 +1,35 @@
+package track
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ServeTrack responds with the layout generated by the `seed` and `preset` query parameters
+// (e.g. /track?seed=42&preset=oval). The preset defaults to "default"
+func ServeTrack(w http.ResponseWriter, r *http.Request) {
+	seed, err := strconv.ParseInt(r.URL.Query().Get("seed"), 10, 64)
+	if err != nil {
+		http.Error(w, "seed must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	name := r.URL.Query().Get("preset")
+	if name == "" {
+		name = "default"
+	}
+
+	cfg, ok := Presets[name]
+	if !ok {
+		http.Error(w, "unknown preset: "+name, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(NewFromConfig(cfg, seed))
+	if err != nil {
+		log.Println("TRACK: " + err.Error())
+	}
+}
@@ -0,0 +1,47 @@
+package track
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// Source supplies the tracks to race on
+type Source interface {
+	// Next returns the track of the next race
+	Next() Track
+}
+
+// Generator is a source of randomly generated tracks shaped by the config
+type Generator struct {
+	Config GeneratorConfig
+}
+
+// Next generates a track from a random seed
+func (g Generator) Next() Track {
+	return NewFromConfig(g.Config, rand.Int63())
+}
+
+// Rotation is a source that cycles through a fixed list of tracks.
+// It is safe for concurrent use
+type Rotation struct {
+	mu     sync.Mutex
+	tracks []Track
+	next   int
+}
+
+// NewRotation creates a rotation starting at the first of the tracks.
+// The list must not be empty
+func NewRotation(tracks []Track) *Rotation {
+	return &Rotation{tracks: tracks}
+}
+
+// Next returns the next track of the list, starting over after the last one
+func (r *Rotation) Next() Track {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.tracks[r.next]
+	r.next = (r.next + 1) % len(r.tracks)
+
+	return t
+}
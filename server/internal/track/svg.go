@@ -0,0 +1,205 @@
+package track
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gitlab.com/resamvi/sennai/pkg/math"
+)
+
+// ImportSVG converts the first <path> element of an SVG document into a track file.
+// Only straight path commands (M, L, H, V, Z and their relative forms) are supported.
+// The track width is half of the path's stroke-width (or the default width if it has none)
+func ImportSVG(data []byte) (File, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return File{}, errors.New("svg contains no path")
+		}
+		if err != nil {
+			return File{}, err
+		}
+
+		elem, ok := token.(xml.StartElement)
+		if !ok || elem.Name.Local != "path" {
+			continue
+		}
+
+		f := File{Version: Version, Width: Default.Width}
+		for _, attr := range elem.Attr {
+			switch attr.Name.Local {
+			case "d":
+				f.Center, err = ParsePath(attr.Value)
+				if err != nil {
+					return File{}, err
+				}
+
+			case "stroke-width":
+				width, err := strconv.ParseFloat(strings.TrimSuffix(attr.Value, "px"), 64)
+				if err != nil {
+					return File{}, fmt.Errorf("stroke-width: %w", err)
+				}
+				f.Width = width / 2
+
+			case "id":
+				f.Name = attr.Value
+			}
+		}
+
+		return f, nil
+	}
+}
+
+// ParsePath converts the path data (the `d` attribute) of an SVG path into an outline
+func ParsePath(d string) (Outline, error) {
+	tokens := tokenize(d)
+
+	ol := Outline{}
+	cur, start := math.Point{}, math.Point{}
+	cmd := ' '
+
+	for i := 0; i < len(tokens); {
+		if command(tokens[i]) {
+			cmd = rune(tokens[i][0])
+			i++
+		}
+
+		relative := unicode.IsLower(cmd)
+
+		switch unicode.ToUpper(cmd) {
+		case 'Z':
+			cur = start
+			ol.Push(cur)
+
+			if i < len(tokens) && !command(tokens[i]) {
+				return nil, errors.New("closepath takes no coordinates")
+			}
+			continue
+
+		case 'M', 'L':
+			x, y, err := numbers(tokens, i)
+			if err != nil {
+				return nil, err
+			}
+			i += 2
+
+			if relative {
+				x, y = cur.X+x, cur.Y+y
+			}
+			cur = math.Point{X: x, Y: y}
+
+			if unicode.ToUpper(cmd) == 'M' {
+				start = cur
+
+				// Subsequent pairs after a moveto are implicit lineto commands
+				if relative {
+					cmd = 'l'
+				} else {
+					cmd = 'L'
+				}
+			}
+
+		case 'H', 'V':
+			if i >= len(tokens) {
+				return nil, errors.New("path ends unexpectedly")
+			}
+
+			v, err := strconv.ParseFloat(tokens[i], 64)
+			if err != nil {
+				return nil, err
+			}
+			i++
+
+			horizontal := unicode.ToUpper(cmd) == 'H'
+			switch {
+			case horizontal && relative:
+				cur.X += v
+			case horizontal:
+				cur.X = v
+			case relative:
+				cur.Y += v
+			default:
+				cur.Y = v
+			}
+
+		default:
+			return nil, fmt.Errorf("unsupported path command %q", cmd)
+		}
+
+		ol.Push(cur)
+	}
+
+	return ol, nil
+}
+
+// command reports whether the token is a path command
+func command(token string) bool {
+	return len(token) == 1 && unicode.IsLetter(rune(token[0]))
+}
+
+// numbers parses the coordinate pair at position i of the tokens
+func numbers(tokens []string, i int) (float64, float64, error) {
+	if i+1 >= len(tokens) {
+		return 0, 0, errors.New("path ends unexpectedly")
+	}
+
+	x, err := strconv.ParseFloat(tokens[i], 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	y, err := strconv.ParseFloat(tokens[i+1], 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return x, y, nil
+}
+
+// tokenize splits path data into commands and numbers
+// e.g. "M10-20L5e1,3z" -> ["M", "10", "-20", "L", "5e1", "3", "z"]
+func tokenize(d string) []string {
+	tokens := make([]string, 0)
+	current := ""
+
+	flush := func() {
+		if current != "" {
+			tokens = append(tokens, current)
+			current = ""
+		}
+	}
+
+	for _, r := range d {
+		switch {
+		case r == 'e' || r == 'E':
+			current += string(r)
+		case unicode.IsLetter(r):
+			flush()
+			tokens = append(tokens, string(r))
+		case r == '-' || r == '+':
+			// A sign starts a new number unless it belongs to an exponent
+			if !strings.HasSuffix(current, "e") && !strings.HasSuffix(current, "E") {
+				flush()
+			}
+			current += string(r)
+		case r == '.' && strings.Contains(current, "."):
+			flush()
+			current += string(r)
+		case unicode.IsDigit(r) || r == '.':
+			current += string(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return tokens
+}
@@ -9,80 +9,67 @@ import (
 	"gitlab.com/resamvi/sennai/pkg/math"
 )
 
-const (
-	pointcount = 40 // has to be >=2
-	iterations = 3
-
-	maxwidth    = 8000.0
-	maxheight   = 6000.0
-	mindistance = 1500.0
-
-	difficulty      = 5
-	maxdisplacement = 800
-
-	// Trackwidth is the width of center <-> border (i.e. total track width is 2*Trackwidth)
-	// and determines the radius of the offroad circle.
-	// An offroad circle is a circle that is centered on the player and as soon as
-	// no point of the track is inside the circle anymore the player is considered "offroad"
-	Trackwidth = 400
-)
-
 // Track repesents the layout and stores the outline and bounds of a track
 type Track struct {
-	Outer  Outline `json:"outer"`
-	Center Outline `json:"center"`
-	Inner  Outline `json:"inner"`
+	Name   string       `json:"name,omitempty"`   // only set for tracks loaded from a file
+	Preset string       `json:"preset,omitempty"` // generator preset the seed belongs to (see Presets)
+	Seed   int64        `json:"seed"`             // generating the track from the same seed (and preset) results in the same layout
+	Width  float64      `json:"width"`            // distance of center <-> border (i.e. total track width is 2*Width)
+	Finish math.Segment `json:"finish"`           // the start/finish line
+	Grid   []Slot       `json:"grid"`             // starting positions in order
+	Outer  Outline      `json:"outer"`
+	Center Outline      `json:"center"`
+	Inner  Outline      `json:"inner"`
 }
 
+// Slot is a starting position on the grid
+type Slot struct {
+	Position math.Point `json:"position"`
+	Rotation float64    `json:"rotation"` // heading in degrees
+}
+
+const (
+	startindex  = 10   // index of the center line where the start/finish line is placed
+	gridsize    = 8    // amount of starting positions
+	gridspacing = 80.0 // distance between two rows of the grid
+)
+
 // Outline is a chain of points to create a line
 type Outline []math.Point
 
-// New creates a new track
+// New creates a new track from a random seed
 func New() Track {
-	outline := Outline{}
-	for i := 0; i < pointcount; i++ {
-		p := math.Point{X: rand.Float64() * maxwidth, Y: rand.Float64() * maxheight}
-		outline.Push(p)
-	}
-
-	track := outline.Hull().
-		SpaceApart().
-		SpaceApart().
-		SpaceApart().
-		SharpenCorners().
-		Smoothen()
-
-	inner, outer := track.Inner(), track.Outer()
-
-	// Remove interfering points
-	for _, p1 := range track {
-
-		for k := 0; k < len(inner); k++ {
-			p2 := inner[k]
+	return NewFromSeed(rand.Int63())
+}
 
-			if p1 == p2 {
-				continue
-			}
+// NewFromSeed creates the track belonging to the seed.
+// The same seed always results in the same track
+func NewFromSeed(seed int64) Track {
+	return NewFromConfig(Default, seed)
+}
 
-			if p1.DistanceTo(p2)+2 < Trackwidth {
-				inner.Remove(k)
-			}
-		}
+// Slot returns the starting position of the i-th car.
+// Cars share starting positions if there are more cars than slots
+func (t Track) Slot(i int) Slot {
+	if len(t.Grid) == 0 {
+		return Slot{}
+	}
 
-		for k := 0; k < len(outer); k++ {
-			p2 := outer[k]
+	return t.Grid[i%len(t.Grid)]
+}
 
-			if p1 == p2 {
-				continue
-			}
+// Walls returns the segments of both track sides with each side closed into a loop
+func (t Track) Walls() []math.Segment {
+	walls := make([]math.Segment, 0, len(t.Inner)+len(t.Outer)+2)
+	for _, side := range []Outline{t.Inner, t.Outer} {
+		walls = append(walls, side.Segments()...)
 
-			if p1.DistanceTo(p2)+2 < Trackwidth {
-				outer.Remove(k)
-			}
+		if len(side) > 2 && side[0] != side[len(side)-1] {
+			walls = append(walls, math.Segment{A: side[len(side)-1], B: side[0]})
 		}
 	}
 
-	return Track{Inner: inner, Center: track, Outer: outer}
+	return walls
 }
 
 // String returns a conscise representation of all points in the track
@@ -206,7 +193,7 @@ func (ol Outline) Hull() Outline {
 }
 
 // SpaceApart returns a version of the outline with every point spaced apart by atleast mindistance
-func (ol Outline) SpaceApart() Outline {
+func (ol Outline) SpaceApart(mindistance float64) Outline {
 	modified := make(Outline, 0)
 
 	for _, p1 := range ol {
@@ -234,15 +221,17 @@ func (ol Outline) SpaceApart() Outline {
 }
 
 // SharpenCorners makes the outline more interesting (i.e. curvy) with sharper corners
-func (ol Outline) SharpenCorners() Outline {
+// that are randomly displaced by rng. The displacement is atmost maxdisplacement
+// and the higher the difficulty the less likely a corner is displaced far
+func (ol Outline) SharpenCorners(rng *rand.Rand, difficulty, maxdisplacement float64) Outline {
 	modified := make(Outline, 2*len(ol)-2)
 
 	for i := 0; i < len(ol)-1; i++ {
-		b := rand.Float64()
+		b := rng.Float64()
 		displaceLength := math.Pow(b, difficulty) * maxdisplacement
 
 		displace := math.Vector{X: 1, Y: 0}
-		displace.Rotate(rand.Float64() * 360)
+		displace.Rotate(rng.Float64() * 360)
 		displace.Scale(displaceLength)
 
 		midpoint := math.Interpolate(ol[i], ol[i+1], 0.5)
@@ -271,30 +260,30 @@ func (ol Outline) Smoothen() Outline {
 }
 
 // Inner returns the inner track side i.e. a downscaled version
-// of the outline
+// of the outline that is `width` apart
 // ————————————————┑
 //                 │
 // ———— t ————┑    |
 //            |    │
 // —inner—┑   |    │
 //        │   |    │
-func (ol Outline) Inner() Outline {
-	return ol.bounds(1.0)
+func (ol Outline) Inner(width float64) Outline {
+	return ol.bounds(1.0, width)
 }
 
 // Outer returns the outer track side i.e. a upscaled version
-// of the outline
+// of the outline that is `width` apart
 // ————outer———————┑
 //                 │
 // ———— t ————┑    |
 //            |    │
 // ———————┑   |    │
 //        │   |    │
-func (ol Outline) Outer() Outline {
-	return ol.bounds(-1.0)
+func (ol Outline) Outer(width float64) Outline {
+	return ol.bounds(-1.0, width)
 }
 
-func (ol Outline) bounds(sign float64) Outline {
+func (ol Outline) bounds(sign float64, width float64) Outline {
 	modified := make(Outline, 0)
 	for i := 0; i < len(ol)-1; i++ {
 		from, to := ol[i], ol[i+1]
@@ -302,7 +291,7 @@ func (ol Outline) bounds(sign float64) Outline {
 		direction := math.Vector{X: from.X - to.X, Y: from.Y - to.Y}
 		direction.Rotate(sign * 90)
 		direction.Normalize()
-		direction.Scale(Trackwidth)
+		direction.Scale(width)
 
 		to.MoveBy(direction)
 		modified.Push(to)
@@ -312,6 +301,53 @@ func (ol Outline) bounds(sign float64) Outline {
 	return modified
 }
 
+// Segments splits the outline into the segments between consecutive points
+func (ol Outline) Segments() []math.Segment {
+	result := make([]math.Segment, 0, len(ol))
+	for i := 0; i < len(ol)-1; i++ {
+		result = append(result, math.Segment{A: ol[i], B: ol[i+1]})
+	}
+
+	return result
+}
+
+// Length returns the length of the line going through every point of the outline
+func (ol Outline) Length() float64 {
+	length := 0.0
+	for _, s := range ol.Segments() {
+		length += s.A.DistanceTo(s.B)
+	}
+
+	return length
+}
+
+// behind walks the closed outline backwards from point i for the given distance
+// and returns the reached point together with the heading (in degrees) along the outline there
+func (ol Outline) behind(i int, distance float64) (math.Point, float64) {
+	n := len(ol)
+	if ol[0] == ol[n-1] {
+		n-- // last point repeats the first one
+	}
+
+	if ol.Length() == 0 {
+		return ol[i%n], 0
+	}
+
+	for {
+		from, to := ol[(i-1+n)%n], ol[i%n]
+
+		length := from.DistanceTo(to)
+		heading := math.VectorFromTo(from, to).Angle()
+
+		if length >= distance {
+			return math.Interpolate(to, from, distance/length), heading
+		}
+
+		distance -= length
+		i = (i - 1 + n) % n
+	}
+}
+
 // xs returns every point's x-value in a slice
 func (ol Outline) xs() []float64 {
 	result := make([]float64, 0)
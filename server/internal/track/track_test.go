@@ -1,6 +1,9 @@
 package track
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"gitlab.com/resamvi/sennai/pkg/math"
@@ -73,3 +76,55 @@ func TestRemove(t *testing.T) {
 		})
 	}
 }
+
+func TestNewFromSeed(t *testing.T) {
+	a, b, c := NewFromSeed(42), NewFromSeed(42), NewFromSeed(43)
+
+	if a.Seed != 42 {
+		t.Errorf("got seed %d, want 42", a.Seed)
+	}
+
+	if !a.Center.Equal(b.Center) || !a.Inner.Equal(b.Inner) || !a.Outer.Equal(b.Outer) {
+		t.Errorf("same seed generated different tracks")
+	}
+
+	if a.Center.Equal(c.Center) {
+		t.Errorf("different seeds generated the same track")
+	}
+}
+
+func TestPresets(t *testing.T) {
+	for name, cfg := range Presets {
+		t.Run(name, func(t *testing.T) {
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("invalid preset: %v", err)
+			}
+
+			trk := NewFromConfig(cfg, 1)
+			if trk.Width != cfg.Width {
+				t.Errorf("got width %v, want %v", trk.Width, cfg.Width)
+			}
+
+			if trk.Preset != name {
+				t.Errorf("got preset %q, want %q", trk.Preset, name)
+			}
+
+			// the layout can be reproduced from the seed and preset
+			w := httptest.NewRecorder()
+			ServeTrack(w, httptest.NewRequest(http.MethodGet, "/track?seed=1&preset="+name, nil))
+
+			var served Track
+			if err := json.NewDecoder(w.Body).Decode(&served); err != nil {
+				t.Fatalf("served track: %v", err)
+			}
+
+			if !served.Center.Equal(trk.Center) {
+				t.Errorf("served a different layout for seed 1")
+			}
+
+			if len(trk.Center) == 0 || len(trk.Inner) == 0 || len(trk.Outer) == 0 {
+				t.Errorf("generated an empty track")
+			}
+		})
+	}
+}
@@ -28,3 +28,35 @@ func Sin(alpha float64) float64 {
 
 	return math.Sin(rad)
 }
+
+// NormalizeAngle maps the degree argument alpha into the range of (-180, 180]
+func NormalizeAngle(alpha float64) float64 {
+	alpha = math.Mod(alpha, 360)
+
+	if alpha > 180 {
+		alpha -= 360
+	}
+	if alpha <= -180 {
+		alpha += 360
+	}
+
+	return alpha
+}
+
+// Ceil returns the least integer value >= x
+func Ceil(x float64) float64 {
+	return math.Ceil(x)
+}
+
+// Clamp limits x to the range of [min, max]
+func Clamp(x, min, max float64) float64 {
+	if x < min {
+		return min
+	}
+
+	if x > max {
+		return max
+	}
+
+	return x
+}
@@ -0,0 +1,129 @@
+package math
+
+// Segment is the straight line between the points A and B
+type Segment struct {
+	A Point `json:"a"`
+	B Point `json:"b"`
+}
+
+// Intersect returns the point where both segments cross.
+// The second return value is false if the segments do not cross (or are parallel)
+func (s Segment) Intersect(t Segment) (Point, bool) {
+	r := VectorFromTo(s.A, s.B)
+	q := VectorFromTo(t.A, t.B)
+
+	denom := cross(r, q)
+	if denom == 0 {
+		return Point{}, false
+	}
+
+	diff := VectorFromTo(s.A, t.A)
+	u := cross(diff, q) / denom // position on s
+	v := cross(diff, r) / denom // position on t
+
+	if u < 0 || u > 1 || v < 0 || v > 1 {
+		return Point{}, false
+	}
+
+	return Interpolate(s.A, s.B, u), true
+}
+
+// Cast sends a ray from `origin` in direction `dir` and returns the distance
+// until the ray hits the segment. The second return value is false if it is never hit
+func (s Segment) Cast(origin Point, dir Vector) (float64, bool) {
+	q := VectorFromTo(s.A, s.B)
+
+	denom := cross(dir, q)
+	if denom == 0 {
+		return 0, false
+	}
+
+	diff := VectorFromTo(origin, s.A)
+	u := cross(diff, q) / denom // position on ray (in multiples of dir)
+	v := cross(diff, dir) / denom
+
+	if u < 0 || v < 0 || v > 1 {
+		return 0, false
+	}
+
+	return u * dir.Len(), true
+}
+
+// Closest returns the point on the segment that is closest to p
+func (s Segment) Closest(p Point) Point {
+	d := VectorFromTo(s.A, s.B)
+
+	length := d.Dot(d)
+	if length == 0 {
+		return s.A
+	}
+
+	t := VectorFromTo(s.A, p).Dot(d) / length
+	if t < 0 {
+		t = 0
+	}
+	if t > 1 {
+		t = 1
+	}
+
+	return Interpolate(s.A, s.B, t)
+}
+
+// Side returns the signed distance of p to the (infinitely extended) segment.
+// It is positive if p is clockwise of the direction A -> B i.e. right of it on screen
+func (s Segment) Side(p Point) float64 {
+	d := VectorFromTo(s.A, s.B)
+
+	length := d.Len()
+	if length == 0 {
+		return 0
+	}
+
+	return cross(d, VectorFromTo(s.A, p)) / length
+}
+
+// cross returns the z-component of the cross product of the two vectors
+func cross(v, w Vector) float64 {
+	return v.X*w.Y - v.Y*w.X
+}
+
+// ClosestPoints returns the pair of points (one on each segment) that are closest to each other
+func (s Segment) ClosestPoints(t Segment) (Point, Point) {
+	d1 := VectorFromTo(s.A, s.B)
+	d2 := VectorFromTo(t.A, t.B)
+	r := VectorFromTo(t.A, s.A)
+
+	a, e, f := d1.Dot(d1), d2.Dot(d2), d2.Dot(r)
+
+	// Either segment may be degenerated into a point
+	if a == 0 && e == 0 {
+		return s.A, t.A
+	}
+
+	if a == 0 {
+		return s.A, t.Closest(s.A)
+	}
+
+	if e == 0 {
+		return s.Closest(t.A), t.A
+	}
+
+	c, b := d1.Dot(r), d1.Dot(d2)
+	denom := a*e - b*b
+
+	// Position on s (arbitrary if parallel)
+	u := 0.0
+	if denom != 0 {
+		u = Clamp((b*f-c*e)/denom, 0, 1)
+	}
+
+	// Position on t, moving u again if v had to be clamped
+	v := (b*u + f) / e
+	if v < 0 {
+		v, u = 0, Clamp(-c/a, 0, 1)
+	} else if v > 1 {
+		v, u = 1, Clamp((b-c)/a, 0, 1)
+	}
+
+	return Interpolate(s.A, s.B, u), Interpolate(t.A, t.B, v)
+}
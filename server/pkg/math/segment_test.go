@@ -0,0 +1,145 @@
+package math
+
+import (
+	"math"
+	"testing"
+)
+
+func TestIntersect(t *testing.T) {
+	var tests = []struct {
+		name  string
+		s     Segment
+		t     Segment
+		want  Point
+		cross bool
+	}{
+		{
+			"Crossing",
+			Segment{Point{X: 0, Y: 0}, Point{X: 2, Y: 2}},
+			Segment{Point{X: 0, Y: 2}, Point{X: 2, Y: 0}},
+			Point{X: 1, Y: 1},
+			true,
+		},
+		{
+			"Too short",
+			Segment{Point{X: 0, Y: 0}, Point{X: 0.5, Y: 0.5}},
+			Segment{Point{X: 0, Y: 2}, Point{X: 2, Y: 0}},
+			Point{},
+			false,
+		},
+		{
+			"Parallel",
+			Segment{Point{X: 0, Y: 0}, Point{X: 2, Y: 0}},
+			Segment{Point{X: 0, Y: 1}, Point{X: 2, Y: 1}},
+			Point{},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.s.Intersect(tt.t)
+			if ok != tt.cross || got != tt.want {
+				t.Errorf("got %v %v, want %v %v", got, ok, tt.want, tt.cross)
+			}
+		})
+	}
+}
+
+func TestCast(t *testing.T) {
+	var tests = []struct {
+		name string
+		dir  Vector
+		want float64
+		hit  bool
+	}{
+		{"Straight hit", Vector{X: 1, Y: 0}, 5, true},
+		{"Scaled direction", Vector{X: 3, Y: 0}, 5, true},
+		{"Pointing away", Vector{X: -1, Y: 0}, 0, false},
+		{"Missing", Vector{X: 0, Y: 1}, 0, false},
+	}
+
+	wall := Segment{Point{X: 5, Y: -1}, Point{X: 5, Y: 1}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := wall.Cast(Point{X: 0, Y: 0}, tt.dir)
+			if ok != tt.hit || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v %v, want %v %v", got, ok, tt.want, tt.hit)
+			}
+		})
+	}
+}
+
+func TestSide(t *testing.T) {
+	s := Segment{Point{X: 0, Y: 0}, Point{X: 10, Y: 0}}
+
+	if got := s.Side(Point{X: 5, Y: 3}); got != 3 {
+		t.Errorf("got %v, want 3", got)
+	}
+
+	if got := s.Side(Point{X: 5, Y: -3}); got != -3 {
+		t.Errorf("got %v, want -3", got)
+	}
+}
+
+func TestNormalizeAngle(t *testing.T) {
+	var tests = []struct {
+		alpha float64
+		want  float64
+	}{
+		{0, 0},
+		{190, -170},
+		{-190, 170},
+		{540, 180},
+		{-180, 180},
+	}
+
+	for _, tt := range tests {
+		got := NormalizeAngle(tt.alpha)
+		if got != tt.want {
+			t.Errorf("NormalizeAngle(%v): got %v, want %v", tt.alpha, got, tt.want)
+		}
+	}
+}
+
+func TestClosestPoints(t *testing.T) {
+	var tests = []struct {
+		name  string
+		s     Segment
+		t     Segment
+		wantS Point
+		wantT Point
+	}{
+		{
+			"Parallel offset",
+			Segment{Point{X: 0, Y: 0}, Point{X: 10, Y: 0}},
+			Segment{Point{X: 20, Y: 5}, Point{X: 30, Y: 5}},
+			Point{X: 10, Y: 0},
+			Point{X: 20, Y: 5},
+		},
+		{
+			"Perpendicular",
+			Segment{Point{X: 0, Y: 0}, Point{X: 10, Y: 0}},
+			Segment{Point{X: 5, Y: 2}, Point{X: 5, Y: 10}},
+			Point{X: 5, Y: 0},
+			Point{X: 5, Y: 2},
+		},
+		{
+			"Point and segment",
+			Segment{Point{X: 3, Y: 4}, Point{X: 3, Y: 4}},
+			Segment{Point{X: 0, Y: 0}, Point{X: 10, Y: 0}},
+			Point{X: 3, Y: 4},
+			Point{X: 3, Y: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotS, gotT := tt.s.ClosestPoints(tt.t)
+			if gotS != tt.wantS || gotT != tt.wantT {
+				t.Errorf("got %v %v, want %v %v", gotS, gotT, tt.wantS, tt.wantT)
+			}
+		})
+	}
+}
@@ -2,35 +2,150 @@
 package pubsub
 
 import (
+	"errors"
 	"sync"
+	"sync/atomic"
 )
 
+// Backlog is the amount of undelivered events after which a subscriber
+// is considered too slow and unsubscribed
+const Backlog = 64
+
+// ErrSlowConsumer is the reason of a subscription that was closed because it fell too far behind
+var ErrSlowConsumer = errors.New("subscriber fell too far behind")
+
+// ErrClosed is the reason of a subscription that ended because the publisher was closed
+var ErrClosed = errors.New("publisher closed")
+
 // Event is sent to every subscriber
 // (i.e. having a reference to Subscription) when something is published
 type Event struct {
-	Typ     string // game's protocol-specific identifier of what the payload entails
+	Typ     string // game's protocol-specific identifier of what the payload entails (i.e. its topic)
 	Payload interface{}
 }
 
-// Subscription holds a channel that is a source of published messages
+// entry is a queued event
+type entry struct {
+	Event
+	latest bool // whether a newer event of the same type replaces it
+}
+
+// Subscription queues published messages until they are taken with Next
 // and stays alive as long as its not closed
 type Subscription struct {
-	Ch     chan Event
-	closed bool
+	ps      *Pubsub
+	filters []Filter // all of them have to accept an event for it to be queued
+	mu      sync.Mutex
+	queue   []entry
+	ready   chan struct{} // signaled when an event is queued and closed when the subscription is
+	closed  bool
+	err     error
+}
+
+// Next blocks until the next event is published and returns it.
+// It returns false once the subscription is closed (see Err)
+func (s *Subscription) Next() (Event, bool) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			e := s.queue[0]
+			s.queue[0] = entry{}
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			return e.Event, true
+		}
+
+		if s.closed {
+			s.mu.Unlock()
+			return Event{}, false
+		}
+		s.mu.Unlock()
+
+		<-s.ready
+	}
+}
+
+// Err returns why the subscription was closed by the publisher (nil if it is open or was unsubscribed)
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
 }
 
 // Unsubscribe should be called when the subscription
-// is not needed to close the channel
+// is not needed anymore. Undelivered events are discarded
 func (s *Subscription) Unsubscribe() {
+	s.ps.remove(s)
+	s.close(nil)
+}
+
+// push queues the event. Latest-wins events replace an undelivered event of the same type
+// which is dropped so the new one is still delivered after everything published before it.
+// It reports whether the event was coalesced and whether the subscriber is too far behind
+func (s *Subscription) push(ev Event, latest bool) (coalesced bool, slow bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false, false
+	}
+
+	if latest {
+		for i := range s.queue {
+			if s.queue[i].latest && s.queue[i].Typ == ev.Typ {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				coalesced = true
+				break
+			}
+		}
+	}
+
+	if len(s.queue) >= Backlog {
+		return coalesced, true
+	}
+
+	s.queue = append(s.queue, entry{Event: ev, latest: latest})
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+
+	return coalesced, false
+}
+
+// close wakes up Next for good. Undelivered events are only kept
+// when the publisher was closed so the subscriber still receives the last ones
+func (s *Subscription) close(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
 	s.closed = true
-	close(s.Ch)
+	s.err = err
+	if err != ErrClosed {
+		s.queue = nil
+	}
+	close(s.ready)
+}
+
+// Stats count what happened to published events
+type Stats struct {
+	Published    uint64 `json:"published"`    // events published
+	Coalesced    uint64 `json:"coalesced"`    // latest-wins events replaced by a newer one before being delivered
+	Disconnected uint64 `json:"disconnected"` // subscribers unsubscribed for falling too far behind
 }
 
 // Pubsub is a communication data structure where
 // all subscribers can listen to new published messages
 type Pubsub struct {
-	mu   sync.RWMutex
-	subs []*Subscription
+	stats  Stats // first so the counters are aligned for atomic access
+	mu     sync.RWMutex
+	subs   []*Subscription
+	closed bool
 }
 
 // New creates a new publisher-subscriber object
@@ -40,35 +155,94 @@ func New() *Pubsub {
 	return ps
 }
 
-// Subscribe will register the given channel
-// to receive published messages
-func (ps *Pubsub) Subscribe() *Subscription {
+// Subscribe will register a new subscription to receive published messages
+// that pass every filter (e.g. see Topics). Without filters every message is received
+func (ps *Pubsub) Subscribe(filters ...Filter) *Subscription {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
-	sub := &Subscription{Ch: make(chan Event, 5), closed: false}
+	sub := &Subscription{ps: ps, filters: filters, ready: make(chan struct{}, 1)}
+	if ps.closed {
+		sub.close(ErrClosed)
+		return sub
+	}
 	ps.subs = append(ps.subs, sub)
 
 	return sub
 }
 
-// Publish will send a new message to all registered channels
+// Close ends every subscription once it received the events published so far
+// (see ErrClosed). Later subscriptions are closed right away
+func (ps *Pubsub) Close() {
+	ps.mu.Lock()
+	subs := ps.subs
+	ps.subs = nil
+	ps.closed = true
+	ps.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.close(ErrClosed)
+	}
+}
+
+// Publish will deliver a new message to all subscribers.
+// Every subscriber receives it unless it falls so far behind that it is unsubscribed
 func (ps *Pubsub) Publish(typ string, data interface{}) {
-	ps.mu.RLock()
-	defer ps.mu.RUnlock()
+	ps.publish(Event{Typ: typ, Payload: data}, false)
+}
 
-	ev := Event{Typ: typ, Payload: data}
+// PublishLatest will deliver a new message to all subscribers that replaces an
+// undelivered message of the same type (e.g. for states of which only the newest matters)
+func (ps *Pubsub) PublishLatest(typ string, data interface{}) {
+	ps.publish(Event{Typ: typ, Payload: data}, true)
+}
 
-	for _, sub := range ps.subs {
+func (ps *Pubsub) publish(ev Event, latest bool) {
+	atomic.AddUint64(&ps.stats.Published, 1)
 
-		if sub.closed {
+	var slow []*Subscription
+
+	ps.mu.RLock()
+	for _, sub := range ps.subs {
+		if !sub.accepts(ev) {
 			continue
 		}
 
-		select {
-		case sub.Ch <- ev:
-		default:
+		coalesced, behind := sub.push(ev, latest)
+		if coalesced {
+			atomic.AddUint64(&ps.stats.Coalesced, 1)
+		}
+		if behind {
+			slow = append(slow, sub)
 		}
+	}
+	ps.mu.RUnlock()
+
+	for _, sub := range slow {
+		ps.remove(sub)
+		sub.close(ErrSlowConsumer)
+		atomic.AddUint64(&ps.stats.Disconnected, 1)
+	}
+}
+
+// remove stops publishing to the subscription
+func (ps *Pubsub) remove(s *Subscription) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for i, sub := range ps.subs {
+		if sub == s {
+			ps.subs = append(ps.subs[:i], ps.subs[i+1:]...)
+			return
+		}
+	}
+}
 
+// Stats returns the counters of published events
+func (ps *Pubsub) Stats() Stats {
+	return Stats{
+		Published:    atomic.LoadUint64(&ps.stats.Published),
+		Coalesced:    atomic.LoadUint64(&ps.stats.Coalesced),
+		Disconnected: atomic.LoadUint64(&ps.stats.Disconnected),
 	}
 }
@@ -0,0 +1,117 @@
+package pubsub
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestPublishLatest(t *testing.T) {
+	ps := New()
+	sub := ps.Subscribe()
+
+	ps.PublishLatest("update", 1)
+	ps.Publish("join", "Senna")
+	ps.PublishLatest("update", 2)
+	ps.PublishLatest("update", 3)
+	ps.Publish("leave", 0)
+
+	// the newest update is not delivered ahead of events published before it
+	want := []Event{{"join", "Senna"}, {"update", 3}, {"leave", 0}}
+	for _, w := range want {
+		got, ok := sub.Next()
+		if !ok || got != w {
+			t.Fatalf("got %v, want %v", got, w)
+		}
+	}
+
+	stats := ps.Stats()
+	if stats.Published != 5 || stats.Coalesced != 2 {
+		t.Errorf("got %+v, want 5 published and 2 coalesced", stats)
+	}
+}
+
+func TestSlowConsumer(t *testing.T) {
+	ps := New()
+	slow := ps.Subscribe()
+	fast := ps.Subscribe()
+
+	for i := 0; i <= Backlog; i++ {
+		ps.Publish("count", i)
+
+		if _, ok := fast.Next(); !ok {
+			t.Fatalf("fast subscriber was closed")
+		}
+	}
+
+	if _, ok := slow.Next(); ok || slow.Err() != ErrSlowConsumer {
+		t.Errorf("got error %v, want %v", slow.Err(), ErrSlowConsumer)
+	}
+
+	if stats := ps.Stats(); stats.Disconnected != 1 {
+		t.Errorf("got %d disconnected, want 1", stats.Disconnected)
+	}
+
+	ps.Publish("count", -1)
+	if ev, ok := fast.Next(); !ok || ev.Payload != -1 {
+		t.Errorf("got %v, want the latest count", ev)
+	}
+}
+
+// TestUnsubscribe is meant to be run with -race
+func TestUnsubscribe(t *testing.T) {
+	ps := New()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sub := ps.Subscribe()
+			for j := 0; j < 10; j++ {
+				sub.Next()
+			}
+			sub.Unsubscribe()
+
+			if _, ok := sub.Next(); ok {
+				t.Errorf("got event after unsubscribing")
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			ps.PublishLatest("update", nil)
+			ps.Publish("join", nil)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	ps := New()
+	sub := ps.Subscribe()
+
+	ps.Publish("shutdown", "bye")
+	ps.Close()
+
+	if ev, ok := sub.Next(); !ok || ev.Typ != "shutdown" {
+		t.Fatalf("got %v, want the event published before closing", ev)
+	}
+
+	if _, ok := sub.Next(); ok || sub.Err() != ErrClosed {
+		t.Errorf("got error %v, want %v", sub.Err(), ErrClosed)
+	}
+
+	if _, ok := ps.Subscribe().Next(); ok {
+		t.Errorf("got event of a closed publisher")
+	}
+}
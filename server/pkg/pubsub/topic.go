@@ -0,0 +1,84 @@
+package pubsub
+
+import (
+	"path"
+)
+
+// Filter decides whether a subscription receives an event
+type Filter func(Event) bool
+
+// Topics returns a filter that accepts events whose type matches one of the patterns.
+// Types may be hierarchical (e.g. `admin/kick`) and patterns use the syntax of path.Match
+// so `*` matches every type of a level (e.g. `admin/*`) and `*` alone every top-level type
+func Topics(patterns ...string) (Filter, error) {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(ev Event) bool {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, ev.Typ); ok {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// accepts reports whether the event passes every filter of the subscription
+func (s *Subscription) accepts(ev Event) bool {
+	for _, f := range s.filters {
+		if !f(ev) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Topic is an event type whose payload is always of type T
+type Topic[T any] struct {
+	Name string
+}
+
+// Publish delivers the payload to every subscriber of the topic (see Pubsub.Publish)
+func (t Topic[T]) Publish(ps *Pubsub, payload T) {
+	ps.Publish(t.Name, payload)
+}
+
+// PublishLatest delivers the payload to every subscriber of the topic
+// replacing an undelivered one (see Pubsub.PublishLatest)
+func (t Topic[T]) PublishLatest(ps *Pubsub, payload T) {
+	ps.PublishLatest(t.Name, payload)
+}
+
+// Subscribe registers a subscription that only receives the events of this topic
+// (that also pass the filters)
+func (t Topic[T]) Subscribe(ps *Pubsub, filters ...Filter) *Typed[T] {
+	only := func(ev Event) bool {
+		_, ok := ev.Payload.(T)
+		return ev.Typ == t.Name && ok
+	}
+
+	return &Typed[T]{ps.Subscribe(append([]Filter{only}, filters...)...)}
+}
+
+// Typed is a subscription whose payloads are all of type T
+type Typed[T any] struct {
+	*Subscription
+}
+
+// Next blocks until the next payload is published and returns it.
+// It returns false once the subscription is closed (see Err)
+func (t *Typed[T]) Next() (T, bool) {
+	ev, ok := t.Subscription.Next()
+	if !ok {
+		var zero T
+		return zero, false
+	}
+
+	return ev.Payload.(T), true
+}
@@ -0,0 +1,68 @@
+package pubsub
+
+import (
+	"testing"
+)
+
+func TestTopics(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		typ      string
+		want     bool
+	}{
+		{"exact", []string{"update"}, "update", true},
+		{"other", []string{"update"}, "newtrack", false},
+		{"any of", []string{"update", "newtrack"}, "newtrack", true},
+		{"wildcard", []string{"*"}, "best", true},
+		{"wildcard stays on its level", []string{"*"}, "admin/kick", false},
+		{"wildcard of a level", []string{"admin/*"}, "admin/kick", true},
+		{"wildcard of another level", []string{"admin/*"}, "chat/hello", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := Topics(tt.patterns...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := filter(Event{Typ: tt.typ}); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Topics("[update"); err == nil {
+		t.Errorf("malformed pattern was accepted")
+	}
+}
+
+func TestTypedTopic(t *testing.T) {
+	ps := New()
+	scores := Topic[int]{Name: "score"}
+
+	all := ps.Subscribe()
+	high := scores.Subscribe(ps, func(ev Event) bool { return ev.Payload.(int) > 10 })
+
+	ps.Publish("chat", "hello")
+	ps.Publish("score", "not a score")
+	scores.Publish(ps, 5)
+	scores.Publish(ps, 50)
+
+	got, ok := high.Next()
+	if !ok || got != 50 {
+		t.Errorf("got %v, want 50", got)
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, ok := all.Next(); !ok {
+			t.Fatalf("unfiltered subscription missed event %d", i)
+		}
+	}
+
+	high.Unsubscribe()
+	if _, ok := high.Next(); ok {
+		t.Errorf("got payload after unsubscribing")
+	}
+}